@@ -1 +1 @@
-go build -o bin/ -tags with_utls,with_quic
\ No newline at end of file
+go build -o bin/ -tags with_utls,with_quic,with_wireguard,with_gvisor
\ No newline at end of file
@@ -0,0 +1,470 @@
+package exporters
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bluegradienthorizon/singtoolbox/parsers"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing-box/transport/sip003"
+	"github.com/sagernet/sing/common/json/badoption"
+	"gopkg.in/yaml.v3"
+)
+
+type ClashExportSettings struct {
+	MixedPort uint16
+
+	URLTestURL       string
+	URLTestInterval  time.Duration
+	URLTestTolerance uint16
+
+	// NameTemplate renames proxies, see RenderProfileName
+	NameTemplate string
+}
+
+func NewClashExportSettings() ClashExportSettings {
+	return ClashExportSettings{
+		MixedPort:        7890,
+		URLTestURL:       "https://www.gstatic.com/generate_204",
+		URLTestInterval:  3 * time.Minute,
+		URLTestTolerance: 50,
+	}
+}
+
+type clashConfig struct {
+	MixedPort   uint16            `yaml:"mixed-port,omitempty"`
+	Mode        string            `yaml:"mode"`
+	Proxies     []clashProxy      `yaml:"proxies"`
+	ProxyGroups []clashProxyGroup `yaml:"proxy-groups"`
+	Rules       []string          `yaml:"rules"`
+}
+
+type clashProxyGroup struct {
+	Name      string   `yaml:"name"`
+	Type      string   `yaml:"type"`
+	Proxies   []string `yaml:"proxies"`
+	URL       string   `yaml:"url,omitempty"`
+	Interval  int      `yaml:"interval,omitempty"`
+	Tolerance uint16   `yaml:"tolerance,omitempty"`
+}
+
+type clashProxy struct {
+	Name              string            `yaml:"name"`
+	Type              string            `yaml:"type"`
+	Server            string            `yaml:"server"`
+	Port              uint16            `yaml:"port"`
+	UUID              string            `yaml:"uuid,omitempty"`
+	Username          string            `yaml:"username,omitempty"`
+	Password          string            `yaml:"password,omitempty"`
+	Cipher            string            `yaml:"cipher,omitempty"`
+	AlterID           *int              `yaml:"alterId,omitempty"`
+	Flow              string            `yaml:"flow,omitempty"`
+	PacketEncoding    string            `yaml:"packet-encoding,omitempty"`
+	UDP               bool              `yaml:"udp,omitempty"`
+	TLS               bool              `yaml:"tls,omitempty"`
+	SNI               string            `yaml:"sni,omitempty"`
+	ServerName        string            `yaml:"servername,omitempty"`
+	SkipCertVerify    bool              `yaml:"skip-cert-verify,omitempty"`
+	ClientFingerprint string            `yaml:"client-fingerprint,omitempty"`
+	ALPN              []string          `yaml:"alpn,omitempty"`
+	ECHOpts           *clashECHOpts     `yaml:"ech-opts,omitempty"`
+	RealityOpts       *clashRealityOpts `yaml:"reality-opts,omitempty"`
+	Network           string            `yaml:"network,omitempty"`
+	WSOpts            *clashWSOpts      `yaml:"ws-opts,omitempty"`
+	GRPCOpts          *clashGRPCOpts    `yaml:"grpc-opts,omitempty"`
+	H2Opts            *clashH2Opts      `yaml:"h2-opts,omitempty"`
+	Plugin            string            `yaml:"plugin,omitempty"`
+	PluginOpts        map[string]any    `yaml:"plugin-opts,omitempty"`
+	Obfs              string            `yaml:"obfs,omitempty"`
+	ObfsPassword      string            `yaml:"obfs-password,omitempty"`
+	CongestionControl string            `yaml:"congestion-controller,omitempty"`
+	UDPRelayMode      string            `yaml:"udp-relay-mode,omitempty"`
+	DisableSNI        bool              `yaml:"disable-sni,omitempty"`
+	Smux              *clashSmux        `yaml:"smux,omitempty"`
+	Ports             string            `yaml:"ports,omitempty"`
+	HopInterval       int               `yaml:"hop-interval,omitempty"`
+	Up                string            `yaml:"up,omitempty"`
+	Down              string            `yaml:"down,omitempty"`
+	Fingerprint       string            `yaml:"fingerprint,omitempty"`
+}
+
+type clashSmux struct {
+	Enabled        bool   `yaml:"enabled"`
+	Protocol       string `yaml:"protocol,omitempty"`
+	MaxConnections int    `yaml:"max-connections,omitempty"`
+	MinStreams     int    `yaml:"min-streams,omitempty"`
+	MaxStreams     int    `yaml:"max-streams,omitempty"`
+	Padding        bool   `yaml:"padding,omitempty"`
+}
+
+type clashECHOpts struct {
+	Enable bool   `yaml:"enable"`
+	Config string `yaml:"config,omitempty"`
+}
+
+type clashRealityOpts struct {
+	PublicKey string `yaml:"public-key"`
+	ShortID   string `yaml:"short-id,omitempty"`
+}
+
+type clashWSOpts struct {
+	Path                string            `yaml:"path,omitempty"`
+	Headers             map[string]string `yaml:"headers,omitempty"`
+	V2RayHTTPUpgrade    bool              `yaml:"v2ray-http-upgrade,omitempty"`
+	MaxEarlyData        uint32            `yaml:"max-early-data,omitempty"`
+	EarlyDataHeaderName string            `yaml:"early-data-header-name,omitempty"`
+}
+
+type clashGRPCOpts struct {
+	ServiceName string `yaml:"grpc-service-name"`
+}
+
+type clashH2Opts struct {
+	Host []string `yaml:"host,omitempty"`
+	Path string   `yaml:"path,omitempty"`
+}
+
+// ExportClashConfig builds a Clash.Meta (mihomo) config. Profiles are expected to be
+// ordered best first, the group order follows them. Profiles Clash cannot
+// express are skipped and reported in the returned errors.
+func ExportClashConfig(profiles []parsers.ProxyProfile, sett ClashExportSettings) ([]byte, []error) {
+	var proxies []clashProxy
+	var names []string
+	var errs []error
+
+	displayNames := profileDisplayNames(profiles, sett.NameTemplate)
+
+	for i := range profiles {
+		proxy, err := profileToClashProxy(&profiles[i], displayNames[i])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ExportClashConfig: %s: %s", displayNames[i], err.Error()))
+			continue
+		}
+		proxies = append(proxies, *proxy)
+		names = append(names, proxy.Name)
+	}
+
+	if len(proxies) == 0 {
+		return nil, append(errs, errors.New("ExportClashConfig: no exportable profiles"))
+	}
+
+	config := clashConfig{
+		MixedPort: sett.MixedPort,
+		Mode:      "rule",
+		Proxies:   proxies,
+		ProxyGroups: []clashProxyGroup{
+			{
+				Name:    SelectorTag,
+				Type:    "select",
+				Proxies: append([]string{URLTestTag}, names...),
+			},
+			{
+				Name:      URLTestTag,
+				Type:      "url-test",
+				Proxies:   names,
+				URL:       sett.URLTestURL,
+				Interval:  int(sett.URLTestInterval / time.Second),
+				Tolerance: sett.URLTestTolerance,
+			},
+		},
+		Rules: []string{"MATCH," + SelectorTag},
+	}
+
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, append(errs, errors.New("ExportClashConfig: "+err.Error()))
+	}
+
+	return data, errs
+}
+
+func profileToClashProxy(p *parsers.ProxyProfile, name string) (*clashProxy, error) {
+	if p.Outbound == nil {
+		return nil, fmt.Errorf("profileToClashProxy: unsupported profile type %s", p.Type())
+	}
+
+	switch o := p.Outbound.Options.(type) {
+	case *option.ShadowsocksOutboundOptions:
+		proxy := newClashProxy(name, "ss", o.ServerOptions)
+		proxy.Cipher = o.Method
+		proxy.Password = o.Password
+		proxy.Smux = clashSmuxFromOptions(o.Multiplex)
+		if err := applyClashShadowsocksPlugin(proxy, o, p.Detours); err != nil {
+			return nil, errors.New("profileToClashProxy: " + err.Error())
+		}
+		return proxy, nil
+	case *option.VMessOutboundOptions:
+		proxy := newClashProxy(name, "vmess", o.ServerOptions)
+		alterID := o.AlterId
+		proxy.UUID = o.UUID
+		proxy.AlterID = &alterID
+		proxy.Cipher = o.Security
+		if proxy.Cipher == "" {
+			proxy.Cipher = "auto"
+		}
+		proxy.PacketEncoding = o.PacketEncoding
+		proxy.Smux = clashSmuxFromOptions(o.Multiplex)
+		applyClashTLS(proxy, o.TLS, false)
+		if err := applyClashTransport(proxy, o.Transport); err != nil {
+			return nil, errors.New("profileToClashProxy: " + err.Error())
+		}
+		return proxy, nil
+	case *option.VLESSOutboundOptions:
+		proxy := newClashProxy(name, "vless", o.ServerOptions)
+		proxy.UUID = o.UUID
+		proxy.Flow = o.Flow
+		// sing-box defaults vless to xudp, mihomo to none
+		proxy.PacketEncoding = "xudp"
+		if o.PacketEncoding != nil {
+			proxy.PacketEncoding = *o.PacketEncoding
+		}
+		proxy.Smux = clashSmuxFromOptions(o.Multiplex)
+		applyClashTLS(proxy, o.TLS, false)
+		if err := applyClashTransport(proxy, o.Transport); err != nil {
+			return nil, errors.New("profileToClashProxy: " + err.Error())
+		}
+		return proxy, nil
+	case *option.TrojanOutboundOptions:
+		proxy := newClashProxy(name, "trojan", o.ServerOptions)
+		proxy.Password = o.Password
+		proxy.Smux = clashSmuxFromOptions(o.Multiplex)
+		applyClashTLS(proxy, o.TLS, true)
+		if err := applyClashTransport(proxy, o.Transport); err != nil {
+			return nil, errors.New("profileToClashProxy: " + err.Error())
+		}
+		return proxy, nil
+	case *option.Hysteria2OutboundOptions:
+		proxy := newClashProxy(name, "hysteria2", o.ServerOptions)
+		proxy.Password = o.Password
+		if o.Obfs != nil && o.Obfs.Type != "" {
+			proxy.Obfs = o.Obfs.Type
+			proxy.ObfsPassword = o.Obfs.Password
+		}
+		if len(o.ServerPorts) > 0 {
+			proxy.Ports = parsers.FormatHysteria2Ports(o.ServerPorts)
+			proxy.HopInterval = int(time.Duration(o.HopInterval).Seconds())
+		}
+		if o.UpMbps > 0 {
+			proxy.Up = strconv.Itoa(o.UpMbps) + " Mbps"
+		}
+		if o.DownMbps > 0 {
+			proxy.Down = strconv.Itoa(o.DownMbps) + " Mbps"
+		}
+		proxy.Fingerprint = p.PinSHA256
+		applyClashTLS(proxy, o.TLS, true)
+		return proxy, nil
+	case *option.TUICOutboundOptions:
+		proxy := newClashProxy(name, "tuic", o.ServerOptions)
+		proxy.UUID = o.UUID
+		proxy.Password = o.Password
+		proxy.CongestionControl = o.CongestionControl
+		proxy.UDPRelayMode = o.UDPRelayMode
+		applyClashTLS(proxy, o.TLS, true)
+		if o.TLS != nil {
+			proxy.DisableSNI = o.TLS.DisableSNI
+		}
+		return proxy, nil
+	case *option.SOCKSOutboundOptions:
+		if o.Version != "" && o.Version != "5" {
+			return nil, fmt.Errorf("profileToClashProxy: unsupported socks version %s", o.Version)
+		}
+		proxy := newClashProxy(name, "socks5", o.ServerOptions)
+		proxy.Username = o.Username
+		proxy.Password = o.Password
+		return proxy, nil
+	case *option.HTTPOutboundOptions:
+		proxy := newClashProxy(name, "http", o.ServerOptions)
+		proxy.Username = o.Username
+		proxy.Password = o.Password
+		applyClashTLS(proxy, o.TLS, true)
+		proxy.TLS = o.TLS != nil && o.TLS.Enabled
+		return proxy, nil
+	default:
+		return nil, fmt.Errorf("profileToClashProxy: unsupported profile type %s", p.Type())
+	}
+}
+
+func newClashProxy(name string, proxyType string, server option.ServerOptions) *clashProxy {
+	return &clashProxy{
+		Name:   name,
+		Type:   proxyType,
+		Server: server.Server,
+		Port:   server.ServerPort,
+		UDP:    true,
+	}
+}
+
+func clashSmuxFromOptions(options *option.OutboundMultiplexOptions) *clashSmux {
+	if options == nil || !options.Enabled {
+		return nil
+	}
+	return &clashSmux{
+		Enabled:        true,
+		Protocol:       options.Protocol,
+		MaxConnections: options.MaxConnections,
+		MinStreams:     options.MinStreams,
+		MaxStreams:     options.MaxStreams,
+		Padding:        options.Padding,
+	}
+}
+
+// applyClashTLS writes TLS fields. Trojan-like proxies always use TLS in Clash and
+// name the server name "sni", the rest use the "tls" switch and "servername".
+func applyClashTLS(proxy *clashProxy, tls *option.OutboundTLSOptions, sniKey bool) {
+	if tls == nil || !tls.Enabled {
+		return
+	}
+
+	if sniKey {
+		proxy.SNI = tls.ServerName
+	} else {
+		proxy.TLS = true
+		proxy.ServerName = tls.ServerName
+	}
+
+	proxy.SkipCertVerify = tls.Insecure
+	proxy.ALPN = tls.ALPN
+
+	if tls.UTLS != nil && tls.UTLS.Enabled {
+		proxy.ClientFingerprint = tls.UTLS.Fingerprint
+	}
+
+	if tls.ECH != nil && tls.ECH.Enabled {
+		proxy.ECHOpts = &clashECHOpts{Enable: true}
+		if len(tls.ECH.Config) > 0 {
+			proxy.ECHOpts.Config = tls.ECH.Config[0]
+		}
+	}
+
+	if tls.Reality != nil && tls.Reality.Enabled {
+		proxy.RealityOpts = &clashRealityOpts{
+			PublicKey: tls.Reality.PublicKey,
+			ShortID:   tls.Reality.ShortID,
+		}
+	}
+}
+
+func applyClashTransport(proxy *clashProxy, transport *option.V2RayTransportOptions) error {
+	if transport == nil || transport.Type == "" {
+		return nil
+	}
+
+	switch transport.Type {
+	case C.V2RayTransportTypeWebsocket:
+		proxy.Network = "ws"
+		proxy.WSOpts = &clashWSOpts{
+			Path:                transport.WebsocketOptions.Path,
+			Headers:             clashHeaders(transport.WebsocketOptions.Headers),
+			MaxEarlyData:        transport.WebsocketOptions.MaxEarlyData,
+			EarlyDataHeaderName: transport.WebsocketOptions.EarlyDataHeaderName,
+		}
+	case C.V2RayTransportTypeHTTPUpgrade:
+		proxy.Network = "ws"
+		proxy.WSOpts = &clashWSOpts{
+			Path:             transport.HTTPUpgradeOptions.Path,
+			Headers:          clashHeaders(transport.HTTPUpgradeOptions.Headers),
+			V2RayHTTPUpgrade: true,
+		}
+		if host := transport.HTTPUpgradeOptions.Host; host != "" {
+			if proxy.WSOpts.Headers == nil {
+				proxy.WSOpts.Headers = make(map[string]string)
+			}
+			proxy.WSOpts.Headers["Host"] = host
+		}
+	case C.V2RayTransportTypeGRPC:
+		proxy.Network = "grpc"
+		proxy.GRPCOpts = &clashGRPCOpts{
+			ServiceName: transport.GRPCOptions.ServiceName,
+		}
+	case C.V2RayTransportTypeHTTP:
+		proxy.Network = "h2"
+		proxy.H2Opts = &clashH2Opts{
+			Host: transport.HTTPOptions.Host,
+			Path: transport.HTTPOptions.Path,
+		}
+	default:
+		return fmt.Errorf("applyClashTransport: transport %s unsupported by clash", transport.Type)
+	}
+
+	return nil
+}
+
+// clashHeaders keeps the first value of every header, Clash has no multi-value headers
+func clashHeaders(headers badoption.HTTPHeader) map[string]string {
+	if len(headers) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if len(v) > 0 {
+			result[k] = v[0]
+		}
+	}
+	return result
+}
+
+// applyClashShadowsocksPlugin is the inverse of the plugin conversion in parsers.ParseClashConfig
+func applyClashShadowsocksPlugin(proxy *clashProxy, o *option.ShadowsocksOutboundOptions, detours []option.Outbound) error {
+	if o.Plugin == "" {
+		if o.Detour == "" {
+			return nil
+		}
+		for _, d := range detours {
+			shadowTLS, ok := d.Options.(*option.ShadowTLSOutboundOptions)
+			if d.Tag != o.Detour || !ok {
+				continue
+			}
+			proxy.Plugin = "shadow-tls"
+			proxy.PluginOpts = map[string]any{
+				"password": shadowTLS.Password,
+				"version":  shadowTLS.Version,
+			}
+			if shadowTLS.TLS != nil {
+				proxy.PluginOpts["host"] = shadowTLS.TLS.ServerName
+			}
+			return nil
+		}
+		return fmt.Errorf("applyClashShadowsocksPlugin: detour %s cannot be expressed as a plugin", o.Detour)
+	}
+
+	args, err := sip003.ParsePluginOptions(o.PluginOptions)
+	if err != nil {
+		return errors.New("applyClashShadowsocksPlugin: " + err.Error())
+	}
+
+	opts := map[string]any{}
+	set := func(key string, arg string) {
+		if v, ok := args.Get(arg); ok && v != "" {
+			opts[key] = v
+		}
+	}
+
+	switch o.Plugin {
+	case "obfs-local":
+		proxy.Plugin = "obfs"
+		set("mode", "obfs")
+		set("host", "obfs-host")
+	case "v2ray-plugin":
+		proxy.Plugin = "v2ray-plugin"
+		opts["mode"] = "websocket"
+		set("mode", "mode")
+		set("host", "host")
+		set("path", "path")
+		if _, ok := args.Get("tls"); ok {
+			opts["tls"] = true
+		}
+		if mux, ok := args.Get("mux"); ok {
+			n, _ := strconv.Atoi(mux)
+			opts["mux"] = n > 0
+		}
+	default:
+		return fmt.Errorf("applyClashShadowsocksPlugin: unsupported plugin %s", o.Plugin)
+	}
+
+	proxy.PluginOpts = opts
+	return nil
+}
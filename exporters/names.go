@@ -0,0 +1,63 @@
+package exporters
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bluegradienthorizon/singtoolbox/parsers"
+)
+
+var namePlaceholderRegexp = regexp.MustCompile(`\{([A-Za-z0-9_-]+)\}`)
+
+// RenderProfileName fills a template such as "{country} {protocol} {delay}ms".
+// Known placeholders are name, tag, id, protocol and source, everything else is looked
+// up in the profile labels. An empty template or result falls back to the name, then the tag.
+func RenderProfileName(p *parsers.ProxyProfile, template string) string {
+	name := strings.Join(strings.Fields(namePlaceholderRegexp.ReplaceAllStringFunc(template, func(placeholder string) string {
+		switch key := placeholder[1 : len(placeholder)-1]; key {
+		case "name":
+			return p.Name
+		case "tag":
+			return p.Tag()
+		case "id":
+			return p.ID
+		case "protocol":
+			return p.Type()
+		case "source":
+			return p.Source
+		default:
+			return p.Labels[key]
+		}
+	})), " ")
+
+	if name == "" {
+		name = strings.TrimSpace(p.Name)
+	}
+	if name == "" {
+		name = p.Tag()
+	}
+	return name
+}
+
+// profileDisplayNames renders a name for every profile, numbering duplicates and
+// avoiding the group tags
+func profileDisplayNames(profiles []parsers.ProxyProfile, template string) []string {
+	used := map[string]bool{
+		SelectorTag: true,
+		URLTestTag:  true,
+		DirectTag:   true,
+	}
+
+	names := make([]string, 0, len(profiles))
+	for i := range profiles {
+		base := RenderProfileName(&profiles[i], template)
+		name := base
+		for n := 2; used[name]; n++ {
+			name = base + " " + strconv.Itoa(n)
+		}
+		used[name] = true
+		names = append(names, name)
+	}
+	return names
+}
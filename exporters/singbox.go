@@ -0,0 +1,204 @@
+package exporters
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/netip"
+	"time"
+
+	"github.com/bluegradienthorizon/singtoolbox/parsers"
+
+	box "github.com/sagernet/sing-box"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/include"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	"github.com/sagernet/sing/common/json"
+	"github.com/sagernet/sing/common/json/badoption"
+)
+
+const (
+	SelectorTag = "proxy"
+	URLTestTag  = "auto"
+	DirectTag   = "direct"
+)
+
+type SingBoxExportSettings struct {
+	// Inbounds with a zero port are not written
+	MixedListen string
+	MixedPort   uint16
+	SocksListen string
+	SocksPort   uint16
+
+	URLTestURL       string
+	URLTestInterval  time.Duration
+	URLTestTolerance uint16
+
+	LogLevel string
+
+	// NameTemplate renames outbounds, see RenderProfileName
+	NameTemplate string
+}
+
+func NewSingBoxExportSettings() SingBoxExportSettings {
+	return SingBoxExportSettings{
+		MixedListen:      "127.0.0.1",
+		MixedPort:        2080,
+		SocksListen:      "127.0.0.1",
+		SocksPort:        0,
+		URLTestURL:       "https://www.gstatic.com/generate_204",
+		URLTestInterval:  3 * time.Minute,
+		URLTestTolerance: 50,
+		LogLevel:         "warn",
+	}
+}
+
+// ExportSingBoxConfig builds a ready-to-run sing-box client config. Profiles are expected
+// to be ordered best first, the group order follows them. Outbounds are tagged with their
+// display names, the profiles themselves are left untouched.
+func ExportSingBoxConfig(profiles []parsers.ProxyProfile, sett SingBoxExportSettings) ([]byte, error) {
+	if len(profiles) == 0 {
+		return nil, errors.New("ExportSingBoxConfig: no profiles")
+	}
+
+	inbounds, err := buildSingBoxInbounds(sett)
+	if err != nil {
+		return nil, errors.New("ExportSingBoxConfig: " + err.Error())
+	}
+
+	tags := profileDisplayNames(profiles, sett.NameTemplate)
+
+	var outbounds []option.Outbound
+	var endpoints []option.Endpoint
+	for i := range profiles {
+		p := profiles[i].Clone()
+		p.SetTag(tags[i])
+		if p.Endpoint != nil {
+			endpoints = append(endpoints, *p.Endpoint)
+		} else {
+			outbounds = append(outbounds, *p.Outbound)
+			outbounds = append(outbounds, p.Detours...)
+		}
+	}
+
+	groups := []option.Outbound{
+		{
+			Type: C.TypeSelector,
+			Tag:  SelectorTag,
+			Options: &option.SelectorOutboundOptions{
+				Outbounds: append([]string{URLTestTag}, tags...),
+				Default:   URLTestTag,
+			},
+		},
+		{
+			Type: C.TypeURLTest,
+			Tag:  URLTestTag,
+			Options: &option.URLTestOutboundOptions{
+				Outbounds: tags,
+				URL:       sett.URLTestURL,
+				Interval:  badoption.Duration(sett.URLTestInterval),
+				Tolerance: sett.URLTestTolerance,
+			},
+		},
+	}
+	outbounds = append(groups, outbounds...)
+	outbounds = append(outbounds, option.Outbound{
+		Type:    C.TypeDirect,
+		Tag:     DirectTag,
+		Options: &option.DirectOutboundOptions{},
+	})
+
+	opts := option.Options{
+		Log: &option.LogOptions{
+			Level:     sett.LogLevel,
+			Timestamp: true,
+		},
+		Inbounds:  inbounds,
+		Outbounds: outbounds,
+		Endpoints: endpoints,
+		Route: &option.RouteOptions{
+			Final:               SelectorTag,
+			AutoDetectInterface: true,
+		},
+	}
+
+	ctx := include.Context(context.Background())
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoderContext(ctx, &buf)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(opts); err != nil {
+		return nil, errors.New("ExportSingBoxConfig: " + err.Error())
+	}
+
+	if err := checkSingBoxConfig(buf.Bytes()); err != nil {
+		return nil, errors.New("ExportSingBoxConfig: " + err.Error())
+	}
+
+	return buf.Bytes(), nil
+}
+
+func buildSingBoxInbounds(sett SingBoxExportSettings) ([]option.Inbound, error) {
+	var inbounds []option.Inbound
+
+	if sett.MixedPort != 0 {
+		listen, err := netip.ParseAddr(sett.MixedListen)
+		if err != nil {
+			return nil, errors.New("buildSingBoxInbounds: invalid mixed listen address: " + err.Error())
+		}
+		inbounds = append(inbounds, option.Inbound{
+			Type: C.TypeMixed,
+			Tag:  "mixed-in",
+			Options: &option.HTTPMixedInboundOptions{
+				ListenOptions: option.ListenOptions{
+					Listen:     common.Ptr(badoption.Addr(listen)),
+					ListenPort: sett.MixedPort,
+				},
+			},
+		})
+	}
+
+	if sett.SocksPort != 0 {
+		listen, err := netip.ParseAddr(sett.SocksListen)
+		if err != nil {
+			return nil, errors.New("buildSingBoxInbounds: invalid socks listen address: " + err.Error())
+		}
+		inbounds = append(inbounds, option.Inbound{
+			Type: C.TypeSOCKS,
+			Tag:  "socks-in",
+			Options: &option.SocksInboundOptions{
+				ListenOptions: option.ListenOptions{
+					Listen:     common.Ptr(badoption.Addr(listen)),
+					ListenPort: sett.SocksPort,
+				},
+			},
+		})
+	}
+
+	if len(inbounds) == 0 {
+		return nil, errors.New("buildSingBoxInbounds: no inbound enabled")
+	}
+
+	return inbounds, nil
+}
+
+// checkSingBoxConfig loads the encoded config the same way `sing-box run` does
+func checkSingBoxConfig(content []byte) error {
+	ctx := include.Context(context.Background())
+
+	opts, err := json.UnmarshalExtendedContext[option.Options](ctx, content)
+	if err != nil {
+		return errors.New("checkSingBoxConfig: " + err.Error())
+	}
+
+	instance, err := box.New(box.Options{
+		Context: ctx,
+		Options: opts,
+	})
+	if err != nil {
+		return errors.New("checkSingBoxConfig: " + err.Error())
+	}
+
+	return instance.Close()
+}
@@ -6,6 +6,7 @@ require (
 	github.com/k0kubun/pp v3.0.1+incompatible
 	github.com/sagernet/sing v0.7.14
 	github.com/sagernet/sing-box v1.12.14
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -3,18 +3,22 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"maps"
 	"net/netip"
 	"os"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/bluegradienthorizon/singtoolbox/exporters"
 	"github.com/bluegradienthorizon/singtoolbox/parsers"
 	"github.com/bluegradienthorizon/singtoolbox/printers"
 	"github.com/bluegradienthorizon/singtoolbox/testers"
 	"github.com/bluegradienthorizon/singtoolbox/tools"
-	"github.com/bluegradienthorizon/singtoolbox/utils"
 
 	box "github.com/sagernet/sing-box"
 	"github.com/sagernet/sing-box/adapter"
@@ -27,6 +31,17 @@ import (
 func main() {
 	inputFile := "link_list.txt"
 	outputFile := "configs.txt"
+	exportNameTemplate := flag.String("name-template", "", `rename exported profiles, e.g. "{country} {protocol} {delay}ms"; empty keeps the remarks`)
+	muxOverride := flag.String("mux", "", `force multiplexing "on" or "off" for every profile that supports it; empty keeps the links' settings`)
+	retestWithFragment := flag.Bool("retest-fragment", false, "re-test profiles that failed over TLS with ClientHello fragmentation, for filtered networks")
+	strictParsing := flag.Bool("strict", false, "drop links TryFixURI would have to repair instead of guessing what they meant")
+	flag.Parse()
+
+	if *muxOverride != "" && *muxOverride != "on" && *muxOverride != "off" {
+		fmt.Printf("Invalid -mux value %q, expected \"on\" or \"off\"\n", *muxOverride)
+		os.Exit(2)
+	}
+
 	tools.DownloadConfigs(inputFile, outputFile, 10*time.Second)
 
 	fmt.Printf("Attempting to load configurations from file: %s\n", outputFile)
@@ -39,37 +54,87 @@ func main() {
 	}
 
 	var profilesConnUris []string
+	// The same link may come from several sources, so keep the source of each line
+	var profilesSources []string
 
+	source := ""
 	content := strings.TrimSpace(string(data))
 	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(line, tools.SourceMarker) {
+			source = strings.TrimPrefix(line, tools.SourceMarker)
+			continue
+		}
 		profilesConnUris = append(profilesConnUris, line)
+		profilesSources = append(profilesSources, source)
 	}
 
-	fmt.Println("before dedup:", len(profilesConnUris))
-	profilesConnUris = utils.DeduplicateConnUris(profilesConnUris)
-	fmt.Println("after dedup:", len(profilesConnUris))
+	// Grouped by code, so the same problem on different hosts lands in one bucket
+	parsingErrors := make(map[string]*parseBucket)
+	parsingWarnings := make(map[string]*parseBucket)
+	uriRepairs := make(map[string]*parseBucket)
 
-	parsingErrorsMap := make(map[string]int)
+	parseProfile := parsers.ParseProfile
+	if *strictParsing {
+		parseProfile = parsers.ParseProfileStrict
+	}
 
-	for _, connUri := range profilesConnUris {
-		p, err := parsers.ParseProfile(connUri)
+	for i, connUri := range profilesConnUris {
+		p, err := parseProfile(connUri)
 
 		if err != nil {
-			parsingErrorsMap[err.Error()]++
+			var parseErr *parsers.ParseError
+			if errors.As(err, &parseErr) {
+				addToParseBucket(parsingErrors, string(parseErr.Code), fmt.Sprintf("%s %s/%s: %v\n      %s",
+					parseErr.Scheme, parseErr.Stage, parseErr.Field, parseErr, parseErr.URI))
+			} else {
+				addToParseBucket(parsingErrors, string(parsers.CodeOther), err.Error())
+			}
 			continue
 		}
 
+		for _, w := range p.Warnings {
+			addToParseBucket(parsingWarnings, string(w.Code), fmt.Sprintf("%s %s: %s\n      %s",
+				p.Type(), w.Field, w.Message, connUri))
+		}
+
+		for _, fix := range p.URIFixes {
+			if fix.IsRepair() {
+				addToParseBucket(uriRepairs, string(fix), connUri)
+			}
+		}
+
+		p.Source = profilesSources[i]
+		if *muxOverride != "" {
+			p.SetMultiplexEnabled(*muxOverride == "on")
+		}
 		profiles = append(profiles, *p)
 	}
 
 	println("parsing errors:")
+	printParseBuckets(parsingErrors)
 
-	for err, count := range parsingErrorsMap {
-		fmt.Println(count, "x", err)
-	}
+	println("parsing warnings:")
+	printParseBuckets(parsingWarnings)
+
+	println("repaired URIs:")
+	printParseBuckets(uriRepairs)
+
+	// Dedup after parsing, so remarks, parameter order and encoding don't hide duplicates
+	fmt.Println("before dedup:", len(profiles))
+	profiles, duplicatesBySource := parsers.DeduplicateProfiles(profiles)
+	fmt.Println("after dedup:", len(profiles))
+	printDuplicatesBySource(duplicatesBySource)
 
 	if len(profiles) == 0 {
 		fmt.Println("! No valid configurations were loaded. Check your source or subscription content.")
+		var schemes []string
+		for _, scheme := range parsers.SupportedSchemes() {
+			if aliases := parsers.SchemeAliases(scheme); len(aliases) > 0 {
+				scheme += " (" + strings.Join(aliases, ", ") + ")"
+			}
+			schemes = append(schemes, scheme)
+		}
+		fmt.Println("Supported schemes:", strings.Join(schemes, ", "))
 		return
 	}
 
@@ -78,14 +143,18 @@ func main() {
 	i := 0
 	for _, p := range profiles {
 		ctx := include.Context(context.Background())
+		var validationOpts option.Options
+		if p.Endpoint != nil {
+			validationOpts.Endpoints = []option.Endpoint{*p.Endpoint}
+		} else {
+			validationOpts.Outbounds = append([]option.Outbound{*p.Outbound}, p.Detours...)
+		}
 		instance, err := box.New(box.Options{
 			Context: ctx,
-			Options: option.Options{
-				Outbounds: []option.Outbound{*p.Outbound},
-			},
+			Options: validationOpts,
 		})
 		if err != nil {
-			validationErrorsMap[p.Outbound.Type+": "+err.Error()]++
+			validationErrorsMap[p.Type()+": "+err.Error()]++
 			continue
 		}
 		instance.Close()
@@ -100,48 +169,39 @@ func main() {
 		fmt.Println(count, "x", err)
 	}
 
-	for i := range profiles {
-		(&profiles[i]).Outbound.Tag = fmt.Sprintf("outbound-%d", i)
+	// IDs double as outbound tags, so test results always map back to their profile
+	i = 0
+	for _, p := range profiles {
+		if err := p.AssignID(); err != nil {
+			fmt.Printf("Skipping %s profile %s: %v\n", p.Type(), p.Name, err)
+			continue
+		}
+		profiles[i] = p
+		i++
 	}
+	profiles = profiles[:i]
 
-	ctx := include.Context(context.Background())
-
-	var outbounds []option.Outbound
-	for _, p := range profiles {
-		outbounds = append(outbounds, *p.Outbound)
+	profileIndexByID := make(map[string]int, len(profiles))
+	for i, p := range profiles {
+		profileIndexByID[p.ID] = i
 	}
 
-	opts := option.Options{
-		Log: &option.LogOptions{
-			Level:     "panic",
-			Timestamp: true,
-		},
-		Inbounds: []option.Inbound{
-			{
-				Type: "socks",
-				Tag:  "socks-in",
-				Options: &option.SocksInboundOptions{
-					ListenOptions: option.ListenOptions{
-						Listen:     common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
-						ListenPort: 1080,
-					},
+	ctx := include.Context(context.Background())
+
+	inbounds := []option.Inbound{
+		{
+			Type: "socks",
+			Tag:  "socks-in",
+			Options: &option.SocksInboundOptions{
+				ListenOptions: option.ListenOptions{
+					Listen:     common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+					ListenPort: 1080,
 				},
 			},
 		},
-		Outbounds: outbounds,
 	}
 
-	instance, err := box.New(box.Options{
-		Context: ctx,
-		Options: opts,
-	})
-
-	if err != nil {
-		fmt.Printf("Create sing-box failed: %v\n", err)
-		return
-	}
-
-	err = instance.Start()
+	instance, err := startTestBox(ctx, profiles, inbounds)
 	if err != nil {
 		fmt.Printf("Start sing-box failed: %v\n", err)
 		return
@@ -161,6 +221,9 @@ func main() {
 
 	rounds := 3
 
+	latencySett := testers.NewLatencyTestSettings()
+	latencySett.Timeout = 30 * time.Second
+
 	for i := range rounds {
 		if latencyTestCtx.Err() != nil {
 			println("test ended prematurely: " + latencyTestCtx.Err().Error())
@@ -168,7 +231,12 @@ func main() {
 		}
 		var outbounds []adapter.Outbound
 		if i == 0 {
-			outbounds = instance.Outbound().Outbounds()
+			// Lookup by tag also resolves endpoints and skips the fallback direct outbound
+			for _, p := range profiles {
+				if o, ok := instance.Outbound().Outbound(p.Tag()); ok {
+					outbounds = append(outbounds, o)
+				}
+			}
 		} else {
 			for _, r := range results {
 				outbounds = append(outbounds, r.Outbound)
@@ -187,9 +255,7 @@ func main() {
 		printDone := make(chan bool)
 		go printer.Start(printDone)
 
-		sett := testers.NewLatencyTestSettings()
-		sett.Timeout = 30 * time.Second
-		res := testers.LatencyTest(latencyTestCtx, sett, outbounds, resChan)
+		res := testers.LatencyTest(latencyTestCtx, latencySett, outbounds, resChan)
 
 		results = results[:0]
 		for _, r := range res {
@@ -201,6 +267,20 @@ func main() {
 		<-printDone
 	}
 
+	if *retestWithFragment && latencyTestCtx.Err() == nil {
+		fragmentInstance, fragmentResults, err := retestWithTLSFragment(latencyTestCtx, latencySett, profiles, results)
+		if err != nil {
+			fmt.Printf("TLS fragment retest failed: %v\n", err)
+		}
+		if fragmentInstance != nil {
+			defer fragmentInstance.Close()
+		}
+		if len(fragmentResults) > 0 {
+			fmt.Printf("working only with TLS fragmentation: %d\n", len(fragmentResults))
+		}
+		results = append(results, fragmentResults...)
+	}
+
 	if len(results) == 0 {
 		println("no good results")
 		os.Exit(-1)
@@ -229,25 +309,60 @@ func main() {
 	}
 
 	success := 0
+	var sortedProfiles []parsers.ProxyProfile
 
 	f, _ := os.Create("out.txt")
 	w := bufio.NewWriter(f)
 	for _, r := range sortedResults {
 		if r.Error == nil {
+			// Results carry the outbound tag, which AssignID set to the profile ID
+			i, ok := profileIndexByID[r.Tag]
+			if !ok {
+				fmt.Printf("No profile with ID %s, skipping result\n", r.Tag)
+				continue
+			}
 			success++
-			i := slices.IndexFunc(profiles, func(p parsers.ProxyProfile) bool {
-				return p.Outbound.Tag == r.Tag
-			})
-			if i == -1 {
-				i = 0
+			profiles[i].SetLabel("delay", strconv.Itoa(int(r.Delay)))
+			sortedProfiles = append(sortedProfiles, profiles[i])
+			marker := ""
+			if profiles[i].Labels["fragment"] != "" {
+				marker = "  [TLS fragment only]"
 			}
-			w.WriteString(profiles[i].ConnURI + "\n")
+			fmt.Printf("%6dms  %-10s %s%s\n", r.Delay, profiles[i].Type(), profiles[i].Name, marker)
+			connURI := profiles[i].ConnURI
+			// Profiles imported from JSON configs or changed by the fragment retest are
+			// exported as share links when possible
+			if strings.HasPrefix(connURI, "{") || profiles[i].Labels["fragment"] != "" {
+				if uri, err := parsers.FormatProfile(&profiles[i]); err == nil {
+					connURI = uri
+				}
+			}
+			w.WriteString(connURI + "\n")
 		}
 	}
 	w.Flush()
 
 	fmt.Printf("success %d\n", success)
 
+	singBoxSett := exporters.NewSingBoxExportSettings()
+	singBoxSett.NameTemplate = *exportNameTemplate
+	singBoxConfig, err := exporters.ExportSingBoxConfig(sortedProfiles, singBoxSett)
+	if err != nil {
+		fmt.Printf("Export sing-box config failed: %v\n", err)
+	} else {
+		os.WriteFile("out.json", singBoxConfig, 0644)
+	}
+
+	clashSett := exporters.NewClashExportSettings()
+	clashSett.NameTemplate = *exportNameTemplate
+	clashConfig, exportErrs := exporters.ExportClashConfig(sortedProfiles, clashSett)
+	for _, err := range exportErrs {
+		fmt.Printf("Export clash config: %v\n", err)
+	}
+	if clashConfig != nil {
+		os.WriteFile("out.yaml", clashConfig, 0644)
+	}
+
 	// for i, o := range filteredOutbounds {
 	// 	downloadTestCtx, downloadTestCtxCancel := context.WithCancel(ctx)
 	// 	defer downloadTestCtxCancel()
@@ -319,3 +434,157 @@ func main() {
 	fmt.Println("Shutting down...")
 	instance.Close()
 }
+
+// parseBucket counts parse errors or warnings sharing a code and keeps a few samples
+type parseBucket struct {
+	count   int
+	samples []string
+}
+
+const parseBucketSamples = 3
+
+func addToParseBucket(buckets map[string]*parseBucket, code string, sample string) {
+	b, ok := buckets[code]
+	if !ok {
+		b = &parseBucket{}
+		buckets[code] = b
+	}
+	b.count++
+	if len(b.samples) < parseBucketSamples {
+		b.samples = append(b.samples, sample)
+	}
+}
+
+func printParseBuckets(buckets map[string]*parseBucket) {
+	codes := slices.Collect(maps.Keys(buckets))
+	slices.SortFunc(codes, func(a, b string) int {
+		return buckets[b].count - buckets[a].count
+	})
+	for _, code := range codes {
+		fmt.Println(buckets[code].count, "x", code)
+		for _, sample := range buckets[code].samples {
+			fmt.Println("    " + sample)
+		}
+	}
+}
+
+func printDuplicatesBySource(duplicatesBySource map[string]int) {
+	sources := slices.Sorted(maps.Keys(duplicatesBySource))
+	slices.SortStableFunc(sources, func(a, b string) int {
+		return duplicatesBySource[b] - duplicatesBySource[a]
+	})
+	for _, source := range sources {
+		name := source
+		if name == "" {
+			name = "(unknown source)"
+		}
+		fmt.Println(duplicatesBySource[source], "duplicates from", name)
+	}
+}
+
+// startTestBox starts a sing-box instance holding the outbounds and endpoints of the profiles
+func startTestBox(ctx context.Context, profiles []parsers.ProxyProfile, inbounds []option.Inbound) (*box.Box, error) {
+	var outbounds []option.Outbound
+	var endpoints []option.Endpoint
+	for _, p := range profiles {
+		if p.Endpoint != nil {
+			endpoints = append(endpoints, *p.Endpoint)
+		} else {
+			outbounds = append(outbounds, *p.Outbound)
+			outbounds = append(outbounds, p.Detours...)
+		}
+	}
+
+	instance, err := box.New(box.Options{
+		Context: ctx,
+		Options: option.Options{
+			Log: &option.LogOptions{
+				Level:     "panic",
+				Timestamp: true,
+			},
+			Inbounds:  inbounds,
+			Outbounds: outbounds,
+			Endpoints: endpoints,
+		},
+	})
+	if err != nil {
+		return nil, errors.New("startTestBox: " + err.Error())
+	}
+
+	if err := instance.Start(); err != nil {
+		instance.Close()
+		return nil, errors.New("startTestBox: " + err.Error())
+	}
+
+	return instance, nil
+}
+
+// retestWithTLSFragment tests the TLS profiles missing from passed again with ClientHello
+// fragmentation, in a separate instance. Profiles that pass only this way are switched to
+// fragmentation in place and labelled "fragment". The instance must be closed by the caller.
+func retestWithTLSFragment(
+	ctx context.Context,
+	sett testers.LatencyTestSettings,
+	profiles []parsers.ProxyProfile,
+	passed []testers.LatencyTestResult,
+) (*box.Box, []testers.LatencyTestResult, error) {
+	// Outbound tags are profile IDs
+	passedIDs := make(map[string]bool)
+	for _, r := range passed {
+		passedIDs[r.Tag] = true
+	}
+
+	// Candidates keep their IDs, which map them back to profiles
+	candidates := make(map[string]parsers.ProxyProfile)
+	profileIndex := make(map[string]int)
+	var candidateList []parsers.ProxyProfile
+	for i := range profiles {
+		if passedIDs[profiles[i].ID] {
+			continue
+		}
+		c := profiles[i].Clone()
+		if c.SetTLSFragment(true) {
+			candidates[c.ID] = c
+			profileIndex[c.ID] = i
+			candidateList = append(candidateList, c)
+		}
+	}
+
+	if len(candidateList) == 0 {
+		return nil, nil, nil
+	}
+
+	instance, err := startTestBox(ctx, candidateList, nil)
+	if err != nil {
+		return nil, nil, errors.New("retestWithTLSFragment: " + err.Error())
+	}
+
+	var outbounds []adapter.Outbound
+	for _, c := range candidateList {
+		if o, ok := instance.Outbound().Outbound(c.Tag()); ok {
+			outbounds = append(outbounds, o)
+		}
+	}
+
+	println(fmt.Sprintf("TLS fragment retest of %d failed profiles", len(outbounds)))
+
+	printer := printers.NewStatsPrinter(len(outbounds))
+	resChan := printer.ResultChan()
+	printDone := make(chan bool)
+	go printer.Start(printDone)
+
+	var results []testers.LatencyTestResult
+	for _, r := range testers.LatencyTest(ctx, sett, outbounds, resChan) {
+		if r.Error != nil {
+			continue
+		}
+		i := profileIndex[r.Tag]
+		profiles[i] = candidates[r.Tag]
+		profiles[i].SetLabel("fragment", "tls")
+		results = append(results, r)
+	}
+
+	<-printDone
+
+	return instance, results, nil
+}
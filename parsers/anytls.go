@@ -0,0 +1,81 @@
+package parsers
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/bluegradienthorizon/singtoolbox/utils"
+
+	"github.com/sagernet/sing-box/option"
+)
+
+type AnyTLSParser struct{}
+
+func (p AnyTLSParser) ParseProfile(connURI string) (*ProxyProfile, error) {
+	connURI, uriFixes, err := utils.TryFixURI(connURI)
+	if err != nil {
+		return nil, paramError(StageURI, "", CodeMalformedURI, "AnyTLSParser.ParseProfile: %w", err)
+	}
+
+	uri, addr, port, err := extractCommonURIData(connURI, "anytls")
+	if err != nil {
+		return nil, fmt.Errorf("AnyTLSParser.ParseProfile: %w", err)
+	}
+
+	params := uri.Query()
+
+	password := uri.User.Username()
+
+	// AnyTLS always runs over TLS, links usually omit the security parameter
+	if params.Get("security") == "" || params.Get("security") == "none" {
+		params.Set("security", "tls")
+	}
+
+	TLSOptions, err := buildOutboundTLSOptions(params, "anytls")
+	if err != nil {
+		return nil, fmt.Errorf("AnyTLSParser.ParseProfile: %w", err)
+	}
+	warnings := tlsWarnings(params, TLSOptions)
+
+	idleSessionCheckInterval, err := parseDurationParam(firstParam(params, "idle_session_check_interval", "idleSessionCheckInterval", "idle-session-check-interval"))
+	if err != nil {
+		return nil, paramError(StageOptions, "idle_session_check_interval", CodeInvalidParam, "AnyTLSParser.ParseProfile: idle_session_check_interval: %w", err)
+	}
+
+	idleSessionTimeout, err := parseDurationParam(firstParam(params, "idle_session_timeout", "idleSessionTimeout", "idle-session-timeout"))
+	if err != nil {
+		return nil, paramError(StageOptions, "idle_session_timeout", CodeInvalidParam, "AnyTLSParser.ParseProfile: idle_session_timeout: %w", err)
+	}
+
+	var minIdleSession int
+	if minIdleSessionStr := firstParam(params, "min_idle_session", "minIdleSession", "min-idle-session"); minIdleSessionStr != "" {
+		minIdleSession, err = strconv.Atoi(minIdleSessionStr)
+		if err != nil || minIdleSession < 0 {
+			return nil, paramError(StageOptions, "min_idle_session", CodeInvalidParam, "AnyTLSParser.ParseProfile: invalid min_idle_session %s", minIdleSessionStr)
+		}
+	}
+
+	o := &option.Outbound{
+		Type: "anytls",
+		Options: &option.AnyTLSOutboundOptions{
+			ServerOptions: option.ServerOptions{
+				Server:     addr,
+				ServerPort: port,
+			},
+			OutboundTLSOptionsContainer: option.OutboundTLSOptionsContainer{
+				TLS: TLSOptions,
+			},
+			Password:                 password,
+			IdleSessionCheckInterval: idleSessionCheckInterval,
+			IdleSessionTimeout:       idleSessionTimeout,
+			MinIdleSession:           minIdleSession,
+		},
+	}
+
+	return &ProxyProfile{
+		Outbound: o,
+		ConnURI:  connURI,
+		Warnings: warnings,
+		URIFixes: uriFixes,
+	}, nil
+}
@@ -0,0 +1,542 @@
+package parsers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type clashConfig struct {
+	// Decoded one by one, so a malformed entry only costs that proxy
+	Proxies []yaml.Node `yaml:"proxies"`
+}
+
+type clashProxy struct {
+	Name              string           `yaml:"name"`
+	Type              string           `yaml:"type"`
+	Server            string           `yaml:"server"`
+	Port              clashInt         `yaml:"port"`
+	UUID              string           `yaml:"uuid"`
+	Password          string           `yaml:"password"`
+	Cipher            string           `yaml:"cipher"`
+	AlterID           clashInt         `yaml:"alterId"`
+	Flow              string           `yaml:"flow"`
+	TLS               bool             `yaml:"tls"`
+	SNI               string           `yaml:"sni"`
+	ServerName        string           `yaml:"servername"`
+	SkipCertVerify    bool             `yaml:"skip-cert-verify"`
+	ClientFingerprint string           `yaml:"client-fingerprint"`
+	ALPN              []string         `yaml:"alpn"`
+	Network           string           `yaml:"network"`
+	PacketEncoding    string           `yaml:"packet-encoding"`
+	Smux              clashSmux        `yaml:"smux"`
+	Plugin            string           `yaml:"plugin"`
+	PluginOpts        map[string]any   `yaml:"plugin-opts"`
+	RealityOpts       clashRealityOpts `yaml:"reality-opts"`
+	WSOpts            clashWSOpts      `yaml:"ws-opts"`
+	GRPCOpts          clashGRPCOpts    `yaml:"grpc-opts"`
+	H2Opts            clashH2Opts      `yaml:"h2-opts"`
+	HTTPUpgradeOpts   clashWSOpts      `yaml:"http-upgrade-opts"`
+	Obfs              string           `yaml:"obfs"`
+	ObfsPassword      string           `yaml:"obfs-password"`
+	CongestionControl string           `yaml:"congestion-controller"`
+	UDPRelayMode      string           `yaml:"udp-relay-mode"`
+	DisableSNI        bool             `yaml:"disable-sni"`
+	Ports             string           `yaml:"ports"`
+	HopInterval       clashInt         `yaml:"hop-interval"`
+	Up                string           `yaml:"up"`
+	Down              string           `yaml:"down"`
+	Fingerprint       string           `yaml:"fingerprint"`
+}
+
+type clashSmux struct {
+	Enabled        bool     `yaml:"enabled"`
+	Protocol       string   `yaml:"protocol"`
+	MaxConnections clashInt `yaml:"max-connections"`
+	MinStreams     clashInt `yaml:"min-streams"`
+	MaxStreams     clashInt `yaml:"max-streams"`
+	Padding        bool     `yaml:"padding"`
+}
+
+type clashRealityOpts struct {
+	PublicKey string `yaml:"public-key"`
+	ShortID   string `yaml:"short-id"`
+}
+
+type clashWSOpts struct {
+	Path             string            `yaml:"path"`
+	Headers          map[string]string `yaml:"headers"`
+	V2RayHTTPUpgrade bool              `yaml:"v2ray-http-upgrade"`
+	MaxEarlyData     clashInt          `yaml:"max-early-data"`
+}
+
+type clashGRPCOpts struct {
+	ServiceName string `yaml:"grpc-service-name"`
+}
+
+type clashH2Opts struct {
+	Host []string `yaml:"host"`
+	Path string   `yaml:"path"`
+}
+
+// clashInt accepts both `port: 443` and `port: "443"`
+type clashInt int
+
+func (i *clashInt) UnmarshalYAML(value *yaml.Node) error {
+	n, err := strconv.Atoi(strings.TrimSpace(value.Value))
+	if err != nil {
+		return fmt.Errorf("line %d: invalid integer %q", value.Line, value.Value)
+	}
+	*i = clashInt(n)
+	return nil
+}
+
+// clashNodeName reads the name of a proxy entry that failed to decode
+func clashNodeName(node *yaml.Node) string {
+	var named struct {
+		Name string `yaml:"name"`
+	}
+	node.Decode(&named)
+	return named.Name
+}
+
+// IsClashConfig reports whether content looks like a Clash / Clash.Meta YAML document
+func IsClashConfig(content string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimRight(line, " \r\t"), "proxies:") {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseClashConfig converts entries of the `proxies:` list into profiles. Every profile
+// gets a synthesized share URI in ConnURI, so it can be exported like any other link.
+func ParseClashConfig(content []byte) ([]ProxyProfile, []error) {
+	var config clashConfig
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return nil, []error{fmt.Errorf("ParseClashConfig: %w", err)}
+	}
+
+	var profiles []ProxyProfile
+	var errs []error
+
+	for i, node := range config.Proxies {
+		var proxy clashProxy
+		if err := node.Decode(&proxy); err != nil {
+			errs = append(errs, fmt.Errorf("ParseClashConfig: proxy #%d (%s): %w", i, clashNodeName(&node), err))
+			continue
+		}
+
+		connURI, err := clashProxyToURI(proxy)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ParseClashConfig: proxy #%d (%s): %w", i, proxy.Name, err))
+			continue
+		}
+
+		profile, err := ParseProfile(connURI)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ParseClashConfig: proxy #%d (%s): %w", i, proxy.Name, err))
+			continue
+		}
+
+		profiles = append(profiles, *profile)
+	}
+
+	return profiles, errs
+}
+
+func clashProxyToURI(proxy clashProxy) (string, error) {
+	if proxy.Server == "" || proxy.Port == 0 {
+		return "", errors.New("clashProxyToURI: missing server or port")
+	}
+
+	switch proxy.Type {
+	case "ss":
+		return clashShadowsocksToURI(proxy)
+	case "vmess":
+		return clashVMessToURI(proxy)
+	case "vless":
+		return clashV2RayLikeToURI(proxy, "vless", proxy.UUID)
+	case "trojan":
+		return clashV2RayLikeToURI(proxy, "trojan", proxy.Password)
+	case "hysteria2":
+		return clashHysteria2ToURI(proxy)
+	case "tuic":
+		return clashTUICToURI(proxy)
+	default:
+		return "", fmt.Errorf("clashProxyToURI: unsupported proxy type %s", proxy.Type)
+	}
+}
+
+func clashBaseURL(proxy clashProxy, scheme string) *url.URL {
+	return &url.URL{
+		Scheme:   scheme,
+		Host:     net.JoinHostPort(proxy.Server, strconv.Itoa(int(proxy.Port))),
+		Fragment: proxy.Name,
+	}
+}
+
+func clashServerName(proxy clashProxy) string {
+	if proxy.SNI != "" {
+		return proxy.SNI
+	}
+	return proxy.ServerName
+}
+
+func clashShadowsocksToURI(proxy clashProxy) (string, error) {
+	u := clashBaseURL(proxy, "ss")
+	u.User = url.UserPassword(proxy.Cipher, proxy.Password)
+
+	query := url.Values{}
+	if proxy.Plugin != "" {
+		plugin, err := clashPluginToSIP003(proxy.Plugin, proxy.PluginOpts)
+		if err != nil {
+			return "", fmt.Errorf("clashShadowsocksToURI: %w", err)
+		}
+		query.Set("plugin", plugin)
+	}
+	clashSmuxToQuery(proxy.Smux, query)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+func clashSmuxToQuery(smux clashSmux, query url.Values) {
+	if !smux.Enabled {
+		return
+	}
+	query.Set("mux", "1")
+	setIfNotEmpty(query, "mux_protocol", smux.Protocol)
+	if smux.MaxConnections > 0 {
+		query.Set("max-connections", strconv.Itoa(int(smux.MaxConnections)))
+	}
+	if smux.MinStreams > 0 {
+		query.Set("min-streams", strconv.Itoa(int(smux.MinStreams)))
+	}
+	if smux.MaxStreams > 0 {
+		query.Set("max-streams", strconv.Itoa(int(smux.MaxStreams)))
+	}
+	if smux.Padding {
+		query.Set("padding", "1")
+	}
+}
+
+func clashPluginToSIP003(plugin string, opts map[string]any) (string, error) {
+	get := func(key string) string {
+		if v, ok := opts[key]; ok && v != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return ""
+	}
+
+	parts := []string{}
+	add := func(key string, value string) {
+		if value != "" {
+			parts = append(parts, key+"="+sip003Escape(value))
+		}
+	}
+
+	switch plugin {
+	case "obfs":
+		parts = append(parts, "obfs-local")
+		add("obfs", get("mode"))
+		add("obfs-host", get("host"))
+	case "v2ray-plugin":
+		parts = append(parts, "v2ray-plugin")
+		add("mode", get("mode"))
+		add("host", get("host"))
+		add("path", get("path"))
+		if get("tls") == "true" {
+			parts = append(parts, "tls")
+		}
+		if get("mux") == "true" {
+			parts = append(parts, "mux=1")
+		}
+	case "shadow-tls":
+		parts = append(parts, "shadow-tls")
+		add("host", get("host"))
+		add("password", get("password"))
+		add("version", get("version"))
+	default:
+		return "", fmt.Errorf("clashPluginToSIP003: unsupported plugin %s", plugin)
+	}
+
+	return strings.Join(parts, ";"), nil
+}
+
+func sip003Escape(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `;`, `\;`, `=`, `\=`)
+	return replacer.Replace(value)
+}
+
+// clashNetwork maps mihomo's `network: ws` + `v2ray-http-upgrade: true` to httpupgrade
+func clashNetwork(proxy clashProxy) string {
+	switch {
+	case proxy.Network == "":
+		return "tcp"
+	case proxy.Network == "ws" && proxy.WSOpts.V2RayHTTPUpgrade:
+		return "httpupgrade"
+	default:
+		return proxy.Network
+	}
+}
+
+func clashHTTPUpgradeOpts(proxy clashProxy) clashWSOpts {
+	if proxy.WSOpts.V2RayHTTPUpgrade {
+		return proxy.WSOpts
+	}
+	return proxy.HTTPUpgradeOpts
+}
+
+// clashVMessHeaders keeps the headers other than Host, which has its own vmess field
+func clashVMessHeaders(headers map[string]string) map[string]string {
+	result := map[string]string{}
+	for name, value := range headers {
+		if !strings.EqualFold(name, "Host") {
+			result[name] = value
+		}
+	}
+	return result
+}
+
+func clashVMessToURI(proxy clashProxy) (string, error) {
+	network := clashNetwork(proxy)
+
+	cipher := proxy.Cipher
+	if cipher == "" {
+		cipher = "auto"
+	}
+
+	fields := map[string]any{
+		"v":    "2",
+		"ps":   proxy.Name,
+		"add":  proxy.Server,
+		"port": strconv.Itoa(int(proxy.Port)),
+		"id":   proxy.UUID,
+		"aid":  strconv.Itoa(int(proxy.AlterID)),
+		"scy":  cipher,
+		"net":  network,
+		"type": "none",
+	}
+
+	if proxy.PacketEncoding != "" {
+		fields["packetEncoding"] = proxy.PacketEncoding
+	}
+	smux := url.Values{}
+	clashSmuxToQuery(proxy.Smux, smux)
+	for k := range smux {
+		fields[k] = smux.Get(k)
+	}
+
+	if proxy.TLS {
+		fields["tls"] = "tls"
+		if sni := clashServerName(proxy); sni != "" {
+			fields["sni"] = sni
+		}
+		if len(proxy.ALPN) > 0 {
+			fields["alpn"] = strings.Join(proxy.ALPN, ",")
+		}
+		if proxy.ClientFingerprint != "" {
+			fields["fp"] = proxy.ClientFingerprint
+		}
+		if proxy.SkipCertVerify {
+			fields["insecure"] = "1"
+		}
+	}
+
+	switch network {
+	case "ws":
+		fields["path"] = proxy.WSOpts.Path
+		fields["host"] = proxy.WSOpts.Headers["Host"]
+		fields["headers"] = clashVMessHeaders(proxy.WSOpts.Headers)
+		if proxy.WSOpts.MaxEarlyData > 0 {
+			fields["ed"] = strconv.Itoa(int(proxy.WSOpts.MaxEarlyData))
+		}
+	case "grpc":
+		fields["path"] = proxy.GRPCOpts.ServiceName
+	case "h2":
+		fields["path"] = proxy.H2Opts.Path
+		fields["host"] = strings.Join(proxy.H2Opts.Host, ",")
+	case "http":
+		// Clash "http" is TCP with HTTP header obfuscation, not the HTTP/2 transport
+		fields["net"] = "tcp"
+		fields["type"] = "http"
+	case "httpupgrade":
+		opts := clashHTTPUpgradeOpts(proxy)
+		fields["path"] = opts.Path
+		fields["host"] = opts.Headers["Host"]
+		fields["headers"] = clashVMessHeaders(opts.Headers)
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("clashVMessToURI: %w", err)
+	}
+
+	return "vmess://" + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// clashV2RayLikeToURI handles vless and trojan, which share the same query layout
+func clashV2RayLikeToURI(proxy clashProxy, scheme string, user string) (string, error) {
+	if user == "" {
+		return "", fmt.Errorf("clashV2RayLikeToURI: missing credentials for %s", scheme)
+	}
+
+	u := clashBaseURL(proxy, scheme)
+	u.User = url.User(user)
+
+	query := url.Values{}
+
+	// trojan is always TLS in Clash, vless only when requested
+	security := "none"
+	if proxy.TLS || scheme == "trojan" {
+		security = "tls"
+	}
+	if proxy.RealityOpts.PublicKey != "" {
+		security = "reality"
+		query.Set("pbk", proxy.RealityOpts.PublicKey)
+		if proxy.RealityOpts.ShortID != "" {
+			query.Set("sid", proxy.RealityOpts.ShortID)
+		}
+	}
+	query.Set("security", security)
+
+	if security != "none" {
+		if sni := clashServerName(proxy); sni != "" {
+			query.Set("sni", sni)
+		}
+		if len(proxy.ALPN) > 0 {
+			query.Set("alpn", strings.Join(proxy.ALPN, ","))
+		}
+		if proxy.ClientFingerprint != "" {
+			query.Set("fp", proxy.ClientFingerprint)
+		}
+		if proxy.SkipCertVerify {
+			query.Set("allowInsecure", "1")
+		}
+	}
+
+	if proxy.Flow != "" {
+		query.Set("flow", proxy.Flow)
+	}
+	if proxy.PacketEncoding != "" {
+		query.Set("packetEncoding", proxy.PacketEncoding)
+	}
+	clashSmuxToQuery(proxy.Smux, query)
+
+	network := clashNetwork(proxy)
+	query.Set("type", network)
+
+	switch network {
+	case "ws":
+		if proxy.WSOpts.Path != "" {
+			query.Set("path", proxy.WSOpts.Path)
+		}
+		if host := proxy.WSOpts.Headers["Host"]; host != "" {
+			query.Set("host", host)
+		}
+		addHeaderParams(query, proxy.WSOpts.Headers)
+		if proxy.WSOpts.MaxEarlyData > 0 {
+			query.Set("ed", strconv.Itoa(int(proxy.WSOpts.MaxEarlyData)))
+		}
+	case "grpc":
+		query.Set("serviceName", proxy.GRPCOpts.ServiceName)
+	case "h2":
+		if proxy.H2Opts.Path != "" {
+			query.Set("path", proxy.H2Opts.Path)
+		}
+		if len(proxy.H2Opts.Host) > 0 {
+			query.Set("host", strings.Join(proxy.H2Opts.Host, ","))
+		}
+	case "http":
+		query.Set("type", "tcp")
+		query.Set("headerType", "http")
+	case "httpupgrade":
+		opts := clashHTTPUpgradeOpts(proxy)
+		if opts.Path != "" {
+			query.Set("path", opts.Path)
+		}
+		if host := opts.Headers["Host"]; host != "" {
+			query.Set("host", host)
+		}
+		addHeaderParams(query, opts.Headers)
+	}
+
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func clashHysteria2ToURI(proxy clashProxy) (string, error) {
+	u := clashBaseURL(proxy, "hysteria2")
+	u.User = url.User(proxy.Password)
+
+	query := url.Values{}
+	if sni := clashServerName(proxy); sni != "" {
+		query.Set("sni", sni)
+	}
+	if proxy.SkipCertVerify {
+		query.Set("insecure", "1")
+	}
+	if proxy.Fingerprint != "" {
+		query.Set("pinSHA256", proxy.Fingerprint)
+	}
+	if proxy.Obfs != "" {
+		query.Set("obfs", proxy.Obfs)
+		query.Set("obfs-password", proxy.ObfsPassword)
+	}
+	if proxy.Ports != "" {
+		query.Set("mport", proxy.Ports)
+	}
+	if proxy.HopInterval > 0 {
+		query.Set("hop_interval", strconv.Itoa(int(proxy.HopInterval)))
+	}
+	if proxy.Up != "" {
+		query.Set("up", proxy.Up)
+	}
+	if proxy.Down != "" {
+		query.Set("down", proxy.Down)
+	}
+
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func clashTUICToURI(proxy clashProxy) (string, error) {
+	if proxy.UUID == "" {
+		return "", errors.New("clashTUICToURI: only TUIC v5 (uuid + password) is supported")
+	}
+
+	u := clashBaseURL(proxy, "tuic")
+	u.User = url.UserPassword(proxy.UUID, proxy.Password)
+
+	query := url.Values{}
+	if sni := clashServerName(proxy); sni != "" {
+		query.Set("sni", sni)
+	}
+	if len(proxy.ALPN) > 0 {
+		query.Set("alpn", strings.Join(proxy.ALPN, ","))
+	}
+	if proxy.CongestionControl != "" {
+		query.Set("congestion_control", proxy.CongestionControl)
+	}
+	if proxy.UDPRelayMode != "" {
+		query.Set("udp_relay_mode", proxy.UDPRelayMode)
+	}
+	if proxy.SkipCertVerify {
+		query.Set("allow_insecure", "1")
+	}
+	if proxy.DisableSNI {
+		query.Set("disable_sni", "1")
+	}
+
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,38 @@
+package parsers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseClashConfigSkipsMalformedProxy(t *testing.T) {
+	content := `proxies:
+  - name: good
+    type: trojan
+    server: example.com
+    port: "443"
+    password: secret
+  - name: bad-port
+    type: trojan
+    server: example.com
+    port: https
+    password: secret
+  - name: also-good
+    type: ss
+    server: example.com
+    port: 8388
+    cipher: aes-256-gcm
+    password: secret
+`
+
+	profiles, errs := ParseClashConfig([]byte(content))
+	if len(profiles) != 2 {
+		t.Fatalf("got %d profiles, want 2", len(profiles))
+	}
+	if len(errs) != 1 {
+		t.Fatalf("got %d errors, want 1: %v", len(errs), errs)
+	}
+	if msg := errs[0].Error(); !strings.Contains(msg, "bad-port") || !strings.Contains(msg, `"https"`) {
+		t.Errorf("error should name the proxy and the bad value: %s", msg)
+	}
+}
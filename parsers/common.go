@@ -1,17 +1,24 @@
 package parsers
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"math"
 	"net"
+	"net/textproto"
 	"net/url"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	C "github.com/sagernet/sing-box/constant"
 	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
 	"github.com/sagernet/sing/common/json/badoption"
 )
 
@@ -37,7 +44,7 @@ func buildOutboundTLSOptions(query url.Values, protocol string) (*option.Outboun
 
 	if security != "" {
 		if (security != "tls") && (security != "reality") && (security != "none") {
-			return nil, fmt.Errorf("buildOutboundTLSOptions: unsupported security parameter %s", security)
+			return nil, paramError(StageTLS, securityKey, CodeUnsupportedParam, "buildOutboundTLSOptions: unsupported security parameter %s", security)
 		}
 
 		if security != "none" {
@@ -70,6 +77,12 @@ func buildOutboundTLSOptions(query url.Values, protocol string) (*option.Outboun
 		if insecure || allowInsecure {
 			options.Insecure = true
 		}
+
+		if options.Enabled {
+			if err := applyTLSFragmentOptions(query, options); err != nil {
+				return nil, fmt.Errorf("buildOutboundTLSOptions: %w", err)
+			}
+		}
 	}
 
 	if security == "reality" {
@@ -91,49 +104,143 @@ func buildOutboundTLSOptions(query url.Values, protocol string) (*option.Outboun
 	return options, nil
 }
 
+// tlsWarnings reports TLS link parameters the built options do not honour
+func tlsWarnings(query url.Values, options *option.OutboundTLSOptions) parseWarnings {
+	var warnings parseWarnings
+	if !options.Enabled {
+		warnings.ignored(query, "TLS is not enabled", "sni", "fp", "alpn", "pbk", "sid")
+		return warnings
+	}
+	if options.Reality != nil && options.Reality.Enabled {
+		warnings.ignored(query, "not supported by the sing-box REALITY client", "spx", "pqv")
+	}
+	if options.Fragment && !options.RecordFragment {
+		warnings.add("fragment", WarnUnenforced, "sing-box 1.12 only fragments together with record_fragment")
+	}
+	return warnings
+}
+
+// applyTLSFragmentOptions maps ClientHello fragmentation parameters. sing-box only has switches,
+// so Xray-style values such as "fragment=1-3,10-20,tlshello" simply enable fragmentation.
+func applyTLSFragmentOptions(query url.Values, options *option.OutboundTLSOptions) error {
+	var err error
+	if options.Fragment, err = parseFragmentSwitch(firstParam(query, "fragment", "tls_fragment", "tlsFragment")); err != nil {
+		return fmt.Errorf("applyTLSFragmentOptions: %w", err)
+	}
+	if options.RecordFragment, err = parseFragmentSwitch(firstParam(query, "record_fragment", "recordFragment", "record-fragment")); err != nil {
+		return fmt.Errorf("applyTLSFragmentOptions: %w", err)
+	}
+
+	delay := strings.TrimSpace(firstParam(query, "fragment_fallback_delay", "fragmentFallbackDelay", "fragment-fallback-delay"))
+	if delay == "" {
+		return nil
+	}
+	// Plain numbers are milliseconds
+	if ms, err := strconv.ParseUint(delay, 10, 32); err == nil {
+		options.FragmentFallbackDelay = badoption.Duration(time.Duration(ms) * time.Millisecond)
+		return nil
+	}
+	d, err := time.ParseDuration(delay)
+	if err != nil || d < 0 {
+		return paramError(StageTLS, "fragment_fallback_delay", CodeInvalidParam, "applyTLSFragmentOptions: invalid fragment fallback delay %s", delay)
+	}
+	options.FragmentFallbackDelay = badoption.Duration(d)
+	return nil
+}
+
+var fragmentSpecRegexp = regexp.MustCompile(`^(tlshello|\d+(-\d+)?)(,(tlshello|\d+(-\d+)?))*$`)
+
+func parseFragmentSwitch(value string) (bool, error) {
+	switch value = strings.ToLower(strings.ReplaceAll(value, " ", "")); value {
+	case "", "0", "false", "off", "no", "none":
+		return false, nil
+	case "1", "true", "on", "yes":
+		return true, nil
+	}
+	if fragmentSpecRegexp.MatchString(value) {
+		return true, nil
+	}
+	return false, paramError(StageTLS, "fragment", CodeInvalidParam, "parseFragmentSwitch: invalid fragment value %s", value)
+}
+
 func buildV2RayTransportOptions(query url.Values, protocol string) (*option.V2RayTransportOptions, error) {
 	options := &option.V2RayTransportOptions{}
 
 	typeKey := "type"
 	serviceNameKey := "serviceName"
+	headerTypeKey := "headerType"
 	// modeKey := "mode"
 
 	if protocol == "vmess" {
 		typeKey = "net"
 		serviceNameKey = "path"
+		headerTypeKey = "type"
 		// modeKey = "type"
 	}
 
 	// spx := query.Get("spx")
 	path := query.Get("path")
-	host := query.Get("host")
-	// headerType := query.Get("headerType")    // "none"
+	host := strings.TrimSpace(query.Get("host"))
+	headerType := query.Get(headerTypeKey)   // "none"
 	serviceName := query.Get(serviceNameKey) // sni or host
-	// authority := query.Get("authority")
 	// seed := query.Get("seed")
 	// mode := query.Get(modeKey)
 
+	headers, err := parseTransportHeaders(query["header"])
+	if err != nil {
+		return nil, fmt.Errorf("buildV2RayTransportOptions: %w", err)
+	}
+
 	type_ := query.Get(typeKey) // "raw"
 
 	switch type_ {
 	case "", "raw", "tcp":
-		// Transport not needed
+		if headerType != "" && headerType != "none" {
+			return nil, paramError(StageTransport, headerTypeKey, CodeUnsupportedParam, "buildV2RayTransportOptions: tcp header type %s unsupported", headerType)
+		}
+		// Transport not needed, an empty one would not marshal
+		return nil, nil
 	case "http", "h2":
 		options.Type = C.V2RayTransportTypeHTTP
+		if host == "" && len(headers["Host"]) > 0 {
+			host = strings.Join(headers["Host"], ",")
+		}
+		delete(headers, "Host")
+		if len(headers) == 0 {
+			headers = nil
+		}
 		options.HTTPOptions = option.V2RayHTTPOptions{
-			Host:   []string{host},
-			Path:   path,
-			Method: "GET",
-			// Headers: , // TODO ??
+			Path:    path,
+			Method:  "GET",
+			Headers: headers,
+		}
+		for _, h := range strings.Split(host, ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				options.HTTPOptions.Host = append(options.HTTPOptions.Host, h)
+			}
 		}
 	case "ws", "websocket":
 		options.Type = C.V2RayTransportTypeWebsocket
+		path, maxEarlyData, err := splitWebsocketEarlyData(path, query.Get("ed"))
+		if err != nil {
+			return nil, fmt.Errorf("buildV2RayTransportOptions: %w", err)
+		}
 		if path == "" {
 			path = "/"
 		}
+		if host != "" {
+			if headers == nil {
+				headers = badoption.HTTPHeader{}
+			}
+			headers["Host"] = []string{host}
+		}
 		options.WebsocketOptions = option.V2RayWebsocketOptions{
-			Path: path,
-			// Headers: , // TODO ??
+			Path:    path,
+			Headers: headers,
+		}
+		if maxEarlyData > 0 {
+			options.WebsocketOptions.MaxEarlyData = maxEarlyData
+			options.WebsocketOptions.EarlyDataHeaderName = websocketEarlyDataHeader
 		}
 	case "quic":
 		options.Type = C.V2RayTransportTypeQUIC
@@ -145,26 +252,461 @@ func buildV2RayTransportOptions(query url.Values, protocol string) (*option.V2Ra
 		}
 	case "httpupgrade":
 		options.Type = C.V2RayTransportTypeHTTPUpgrade
+		if host == "" && len(headers["Host"]) > 0 {
+			host = headers["Host"][0]
+		}
+		delete(headers, "Host")
+		if len(headers) == 0 {
+			headers = nil
+		}
 		options.HTTPUpgradeOptions = option.V2RayHTTPUpgradeOptions{
-			Host: host,
-			Path: path,
-			// Headers: , // TODO ??
-		}
-	case "kcp":
-		return nil, errors.New("buildV2RayTransportOptions: transport kcp unsupported")
-	case "mkcp":
-		return nil, errors.New("buildV2RayTransportOptions: transport mkcp unsupported")
-	case "xhttp":
-		return nil, errors.New("buildV2RayTransportOptions: transport xhttp unsupported")
-	case "splithttp":
-		return nil, errors.New("buildV2RayTransportOptions: transport splithttp unsupported")
+			Host:    host,
+			Path:    path,
+			Headers: headers,
+		}
+	case "kcp", "mkcp", "xhttp", "splithttp":
+		return nil, paramError(StageTransport, typeKey, CodeUnsupportedParam, "buildV2RayTransportOptions: transport %s unsupported", type_)
+	default:
+		return nil, paramError(StageTransport, typeKey, CodeInvalidParam, "buildV2RayTransportOptions: unknown transport %s", type_)
+	}
+
+	return options, nil
+}
+
+// parseTransportHeaders reads repeated "header=Name: Value" query parameters
+func parseTransportHeaders(values []string) (badoption.HTTPHeader, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	headers := badoption.HTTPHeader{}
+	for _, v := range values {
+		name, value, ok := strings.Cut(v, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, paramError(StageTransport, "header", CodeInvalidParam, "parseTransportHeaders: malformed header %q", v)
+		}
+		name = textproto.CanonicalMIMEHeaderKey(name)
+		headers[name] = append(headers[name], strings.TrimSpace(value))
+	}
+
+	return headers, nil
+}
+
+// formatTransportHeaders is the inverse of parseTransportHeaders, Host is left to the caller
+func formatTransportHeaders(headers badoption.HTTPHeader, query url.Values) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		if name != "Host" {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		for _, value := range headers[name] {
+			query.Add("header", name+": "+value)
+		}
+	}
+}
+
+// addHeaderParams adds every header except Host as a "header" query parameter
+func addHeaderParams(query url.Values, headers map[string]string) {
+	httpHeaders := badoption.HTTPHeader{}
+	for name, value := range headers {
+		httpHeaders[textproto.CanonicalMIMEHeaderKey(name)] = []string{value}
+	}
+	formatTransportHeaders(httpHeaders, query)
+}
+
+// applyGRPCAuthority honours the gRPC "authority" parameter. sing-box sends the TLS server
+// name (or the server address without TLS) as :authority, so anything else is rejected.
+func applyGRPCAuthority(query url.Values, server string, tls *option.OutboundTLSOptions, transport *option.V2RayTransportOptions) error {
+	authority := strings.TrimSpace(query.Get("authority"))
+	if authority == "" || transport == nil || transport.Type != C.V2RayTransportTypeGRPC {
+		return nil
+	}
+
+	authorityHost := authority
+	if h, _, err := net.SplitHostPort(authority); err == nil {
+		authorityHost = h
+	}
+
+	if tls != nil && tls.Enabled {
+		if tls.ServerName == "" {
+			tls.ServerName = authorityHost
+		}
+		if tls.ServerName == authorityHost {
+			return nil
+		}
+	} else if server == authorityHost {
+		return nil
+	}
+
+	return paramError(StageTransport, "authority", CodeUnsupportedParam, "applyGRPCAuthority: authority %s differs from the server name", authority)
+}
+
+var multiplexProtocols = map[string]bool{
+	"smux":  true,
+	"yamux": true,
+	"h2mux": true,
+}
+
+// buildOutboundMultiplexOptions maps mux share link parameters. It returns nil when the link
+// has none, so the outbound keeps sing-box's default of no multiplexing.
+func buildOutboundMultiplexOptions(query url.Values) (*option.OutboundMultiplexOptions, error) {
+	mux := strings.ToLower(firstParam(query, "mux", "multiplex"))
+	protocol := strings.ToLower(firstParam(query, "mux_protocol", "mux-protocol", "muxProtocol"))
+
+	// "mux=smux" names the protocol and enables multiplexing at once
+	if multiplexProtocols[mux] {
+		if protocol == "" {
+			protocol = mux
+		}
+		mux = "1"
+	}
+
+	switch mux {
+	case "":
+		return nil, nil
+	case "0", "false", "off", "no":
+		return nil, nil
+	case "1", "true", "on", "yes":
 	default:
-		return nil, fmt.Errorf("buildV2RayTransportOptions: unknown transport %s", type_)
+		return nil, paramError(StageMultiplex, "mux", CodeInvalidParam, "buildOutboundMultiplexOptions: invalid mux value %s", mux)
+	}
+
+	// Some panels write a plain "protocol" next to "mux", only read it once mux is on
+	protocolField := "mux_protocol"
+	if protocol == "" {
+		protocol = strings.ToLower(query.Get("protocol"))
+		protocolField = "protocol"
+	}
+
+	if protocol != "" && !multiplexProtocols[protocol] {
+		return nil, paramError(StageMultiplex, protocolField, CodeUnsupportedParam, "buildOutboundMultiplexOptions: unsupported mux protocol %s", protocol)
+	}
+
+	options := &option.OutboundMultiplexOptions{
+		Enabled:  true,
+		Protocol: protocol,
+	}
+
+	var err error
+	if options.MaxConnections, err = parseMultiplexInt(query, "max-connections", "max_connections", "maxConnections"); err != nil {
+		return nil, fmt.Errorf("buildOutboundMultiplexOptions: %w", err)
+	}
+	if options.MinStreams, err = parseMultiplexInt(query, "min-streams", "min_streams", "minStreams"); err != nil {
+		return nil, fmt.Errorf("buildOutboundMultiplexOptions: %w", err)
+	}
+	if options.MaxStreams, err = parseMultiplexInt(query, "max-streams", "max_streams", "maxStreams"); err != nil {
+		return nil, fmt.Errorf("buildOutboundMultiplexOptions: %w", err)
+	}
+	if options.MaxStreams > 0 && (options.MaxConnections > 0 || options.MinStreams > 0) {
+		return nil, paramError(StageMultiplex, "max-streams", CodeInvalidParam, "buildOutboundMultiplexOptions: max-streams conflicts with max-connections and min-streams")
+	}
+
+	switch padding := strings.ToLower(firstParam(query, "padding", "mux_padding", "mux-padding")); padding {
+	case "", "0", "false":
+	case "1", "true":
+		options.Padding = true
+	default:
+		return nil, paramError(StageMultiplex, "padding", CodeInvalidParam, "buildOutboundMultiplexOptions: invalid padding value %s", padding)
 	}
 
 	return options, nil
 }
 
+func parseMultiplexInt(query url.Values, keys ...string) (int, error) {
+	value := firstParam(query, keys...)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, paramError(StageMultiplex, keys[0], CodeInvalidParam, "parseMultiplexInt: invalid %s value %s", keys[0], value)
+	}
+	return n, nil
+}
+
+// formatOutboundMultiplexQuery is the inverse of buildOutboundMultiplexOptions
+func formatOutboundMultiplexQuery(options *option.OutboundMultiplexOptions, query url.Values) {
+	if options == nil || !options.Enabled {
+		return
+	}
+
+	query.Set("mux", "1")
+	if options.Protocol != "" {
+		query.Set("mux_protocol", options.Protocol)
+	}
+	if options.MaxConnections > 0 {
+		query.Set("max-connections", strconv.Itoa(options.MaxConnections))
+	}
+	if options.MinStreams > 0 {
+		query.Set("min-streams", strconv.Itoa(options.MinStreams))
+	}
+	if options.MaxStreams > 0 {
+		query.Set("max-streams", strconv.Itoa(options.MaxStreams))
+	}
+	if options.Padding {
+		query.Set("padding", "1")
+	}
+}
+
+// parsePacketEncoding reads the VLESS/VMess UDP packet encoding. It returns nil when the
+// link has none, since sing-box defaults VLESS to xudp but "none" means no encoding.
+func parsePacketEncoding(query url.Values) (*string, error) {
+	encoding := strings.ToLower(firstParam(query, "packetEncoding", "packet_encoding", "packet-encoding"))
+	switch encoding {
+	case "":
+		return nil, nil
+	case "none":
+		return common.Ptr(""), nil
+	case "xudp", "packetaddr":
+		return &encoding, nil
+	default:
+		return nil, paramError(StageOptions, "packetEncoding", CodeUnsupportedParam, "parsePacketEncoding: unsupported packet encoding %s", encoding)
+	}
+}
+
+// Xray sends websocket early data in this header, sing-box needs the name spelled out
+const websocketEarlyDataHeader = "Sec-WebSocket-Protocol"
+
+// splitWebsocketEarlyData strips the Xray-style "?ed=2048" suffix from a websocket path.
+// A separate "ed" query parameter is accepted as well.
+func splitWebsocketEarlyData(path string, ed string) (string, uint32, error) {
+	if before, query, ok := strings.Cut(path, "?"); ok {
+		values, err := url.ParseQuery(query)
+		if err == nil && values.Has("ed") {
+			ed = values.Get("ed")
+			values.Del("ed")
+			path = before
+			if rest := values.Encode(); rest != "" {
+				path += "?" + rest
+			}
+		}
+	}
+
+	if ed == "" {
+		return path, 0, nil
+	}
+
+	maxEarlyData, err := strconv.ParseUint(ed, 10, 32)
+	if err != nil {
+		return "", 0, paramError(StageTransport, "ed", CodeInvalidParam, "splitWebsocketEarlyData: invalid early data size %s", ed)
+	}
+
+	return path, uint32(maxEarlyData), nil
+}
+
+// formatOutboundTLSQuery is the inverse of buildOutboundTLSOptions
+func formatOutboundTLSQuery(options *option.OutboundTLSOptions, query url.Values, protocol string) {
+	if options == nil || (!options.Enabled && options.UTLS == nil) {
+		return
+	}
+
+	securityKey := "security"
+
+	if protocol == "vmess" {
+		securityKey = "tls"
+	}
+
+	switch {
+	case !options.Enabled:
+		query.Set(securityKey, "none")
+	case options.Reality != nil && options.Reality.Enabled:
+		query.Set(securityKey, "reality")
+		query.Set("pbk", options.Reality.PublicKey)
+		if options.Reality.ShortID != "" {
+			query.Set("sid", options.Reality.ShortID)
+		}
+	default:
+		query.Set(securityKey, "tls")
+	}
+
+	if options.ServerName != "" {
+		query.Set("sni", options.ServerName)
+	}
+
+	if options.UTLS != nil && options.UTLS.Enabled && options.UTLS.Fingerprint != "" {
+		query.Set("fp", options.UTLS.Fingerprint)
+	}
+
+	if len(options.ALPN) > 0 {
+		query.Set("alpn", strings.Join(options.ALPN, ","))
+	}
+
+	if options.ECH != nil && options.ECH.Enabled && len(options.ECH.Config) > 0 {
+		query.Set("ech", options.ECH.Config[0])
+	}
+
+	if options.Insecure {
+		query.Set("allowInsecure", "1")
+	}
+
+	if options.Fragment {
+		query.Set("fragment", "1")
+	}
+	if options.RecordFragment {
+		query.Set("record_fragment", "1")
+	}
+	if options.FragmentFallbackDelay > 0 {
+		query.Set("fragment_fallback_delay", time.Duration(options.FragmentFallbackDelay).String())
+	}
+}
+
+// formatV2RayTransportQuery is the inverse of buildV2RayTransportOptions
+func formatV2RayTransportQuery(options *option.V2RayTransportOptions, query url.Values, protocol string) error {
+	typeKey := "type"
+	serviceNameKey := "serviceName"
+
+	if protocol == "vmess" {
+		typeKey = "net"
+		serviceNameKey = "path"
+	}
+
+	if options == nil || options.Type == "" {
+		query.Set(typeKey, "tcp")
+		return nil
+	}
+
+	switch options.Type {
+	case C.V2RayTransportTypeHTTP:
+		query.Set(typeKey, "http")
+		if host := strings.Join(options.HTTPOptions.Host, ","); host != "" {
+			query.Set("host", host)
+		}
+		if options.HTTPOptions.Path != "" {
+			query.Set("path", options.HTTPOptions.Path)
+		}
+		formatTransportHeaders(options.HTTPOptions.Headers, query)
+	case C.V2RayTransportTypeWebsocket:
+		query.Set(typeKey, "ws")
+		path := options.WebsocketOptions.Path
+		if options.WebsocketOptions.MaxEarlyData > 0 {
+			if options.WebsocketOptions.EarlyDataHeaderName != websocketEarlyDataHeader {
+				return errors.New("formatV2RayTransportQuery: early data header " + options.WebsocketOptions.EarlyDataHeaderName + " cannot be expressed")
+			}
+			path += "?ed=" + strconv.FormatUint(uint64(options.WebsocketOptions.MaxEarlyData), 10)
+		}
+		if path != "" {
+			query.Set("path", path)
+		}
+		if host := options.WebsocketOptions.Headers["Host"]; len(host) > 0 {
+			query.Set("host", host[0])
+		}
+		formatTransportHeaders(options.WebsocketOptions.Headers, query)
+	case C.V2RayTransportTypeQUIC:
+		query.Set(typeKey, "quic")
+	case C.V2RayTransportTypeGRPC:
+		query.Set(typeKey, "grpc")
+		if options.GRPCOptions.ServiceName != "" {
+			query.Set(serviceNameKey, options.GRPCOptions.ServiceName)
+		}
+	case C.V2RayTransportTypeHTTPUpgrade:
+		query.Set(typeKey, "httpupgrade")
+		if options.HTTPUpgradeOptions.Host != "" {
+			query.Set("host", options.HTTPUpgradeOptions.Host)
+		}
+		if options.HTTPUpgradeOptions.Path != "" {
+			query.Set("path", options.HTTPUpgradeOptions.Path)
+		}
+		formatTransportHeaders(options.HTTPUpgradeOptions.Headers, query)
+	default:
+		return fmt.Errorf("formatV2RayTransportQuery: unknown transport %s", options.Type)
+	}
+
+	return nil
+}
+
+// decodeBase64Lenient accepts padded, unpadded, standard and URL-safe base64
+func decodeBase64Lenient(s string) ([]byte, error) {
+	// '+' may have been turned into a space by query unescaping
+	s = strings.ReplaceAll(strings.TrimSpace(s), " ", "+")
+
+	var decoded []byte
+	var err error
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		decoded, err = enc.DecodeString(s)
+		if err == nil {
+			return decoded, nil
+		}
+	}
+
+	return nil, err
+}
+
+var base64RemarkRegexp = regexp.MustCompile(`^[A-Za-z0-9+/_-]{4,}(={1,2})?$`)
+
+// decodeRemark decodes a percent-encoded remark, then a base64-encoded one. Plain names
+// like "USA1" are valid base64 too, so the remark is only decoded when it is shaped like
+// base64 (padded or a multiple of 4 long) and decodes to text that plain ASCII could not
+// have been: non-ASCII such as emoji, or anything printable if the input was padded.
+func decodeRemark(remark string) string {
+	if unescaped, err := url.PathUnescape(remark); err == nil {
+		remark = unescaped
+	}
+	remark = strings.TrimSpace(remark)
+
+	match := base64RemarkRegexp.FindStringSubmatch(remark)
+	if match == nil {
+		return remark
+	}
+	padded := match[1] != ""
+	if !padded && len(remark)%4 != 0 {
+		return remark
+	}
+
+	decoded, err := decodeBase64Lenient(remark)
+	if err != nil || !isPrintableText(decoded) {
+		return remark
+	}
+	if !padded && !hasNonASCII(decoded) {
+		return remark
+	}
+	return strings.TrimSpace(string(decoded))
+}
+
+func hasNonASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= utf8.RuneSelf {
+			return true
+		}
+	}
+	return false
+}
+
+func isPrintableText(b []byte) bool {
+	if len(b) == 0 || !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) && !unicode.Is(unicode.Variation_Selector, r) && r != 0x200d {
+			return false
+		}
+	}
+	return true
+}
+
+// countryFromFlag returns the ISO 3166 code of the first flag emoji in name
+func countryFromFlag(name string) string {
+	const regionalIndicatorA = 0x1F1E6
+
+	runes := []rune(name)
+	for i := 0; i+1 < len(runes); i++ {
+		a, b := runes[i]-regionalIndicatorA, runes[i+1]-regionalIndicatorA
+		if a >= 0 && a < 26 && b >= 0 && b < 26 {
+			return string([]rune{'A' + a, 'A' + b})
+		}
+	}
+	return ""
+}
+
+// formatServerHost joins server and port, bracketing IPv6 addresses
+func formatServerHost(server option.ServerOptions) string {
+	return net.JoinHostPort(server.Server, strconv.Itoa(int(server.ServerPort)))
+}
+
 func fixTrojanURI(uri string) (*url.URL, error) {
 	remarkSplitLastIndex := strings.LastIndex(uri, "#")
 
@@ -184,7 +726,7 @@ func fixTrojanURI(uri string) (*url.URL, error) {
 
 	lastAt := strings.LastIndex(beforeRemark, "@")
 	if lastAt == -1 {
-		return nil, errors.New("fixTrojanURI: malformed URI: symbol '@' not found")
+		return nil, paramError(StageURI, "", CodeMalformedURI, "fixTrojanURI: malformed URI: symbol '@' not found")
 	}
 
 	beforeAt := beforeRemark[:lastAt]
@@ -192,7 +734,7 @@ func fixTrojanURI(uri string) (*url.URL, error) {
 
 	schemeSplit := strings.SplitN(beforeAt, "://", 2)
 	if len(schemeSplit) < 2 {
-		return nil, errors.New("fixTrojanURI: malformed URI: split by '://' failed")
+		return nil, paramError(StageURI, "", CodeMalformedURI, "fixTrojanURI: malformed URI: split by '://' failed")
 	}
 	scheme := schemeSplit[0]
 	userInfo := schemeSplit[1]
@@ -203,7 +745,14 @@ func fixTrojanURI(uri string) (*url.URL, error) {
 	tempURI := scheme + "://placeholder@" + afterAt
 	u, err := url.Parse(tempURI)
 	if err != nil {
-		return nil, errors.New("fixTrojanURI: " + err.Error())
+		return nil, paramError(StageURI, "", CodeMalformedURI, "fixTrojanURI: %w", err)
+	}
+
+	// TryFixURI query-escapes the userinfo of links with a query. url.User stores it verbatim,
+	// so without this a password such as "p@ss" reached sing-box as "p%40ss". PathUnescape
+	// keeps '+', which QueryEscape only produces from a space that was a '+' in the link.
+	if unescaped, err := url.PathUnescape(userInfo); err == nil {
+		userInfo = unescaped
 	}
 
 	u.User = url.User(userInfo)
@@ -216,14 +765,14 @@ func parseConfigURI(uri string, scheme string) (*url.URL, error) {
 	if scheme == "trojan" {
 		u, err := fixTrojanURI(uri)
 		if err != nil {
-			return nil, errors.New("parseConfigURI: " + err.Error())
+			return nil, fmt.Errorf("parseConfigURI: %w", err)
 		}
 		return u, nil
 	}
 
 	u, err := url.Parse(uri)
 	if err != nil {
-		return nil, errors.New("parseConfigURI: " + err.Error())
+		return nil, paramError(StageURI, "", CodeMalformedURI, "parseConfigURI: %w", err)
 	}
 
 	if u.Scheme == "" {
@@ -279,13 +828,35 @@ func parseNetlocForEndpoint(u *url.URL) (string, uint16, bool) {
 func extractCommonURIData(uri string, scheme string) (*url.URL, string, uint16, error) {
 	parsedURI, err := parseConfigURI(uri, scheme)
 	if err != nil {
-		return nil, "", 0, errors.New("extractCommonURIData: " + err.Error())
+		return nil, "", 0, fmt.Errorf("extractCommonURIData: %w", err)
 	}
 
 	address, port, ok := parseNetlocForEndpoint(parsedURI)
 	if !ok {
-		return nil, "", 0, errors.New("extractCommonURIData: cannot parse netloc for endpoint")
+		return nil, "", 0, paramError(StageURI, "host", CodeInvalidAddress, "extractCommonURIData: cannot parse netloc for endpoint")
 	}
 
 	return parsedURI, address, port, nil
 }
+
+// parseDurationParam accepts Go duration strings ("30s") as well as bare seconds ("30")
+func parseDurationParam(value string) (badoption.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return badoption.Duration(time.Duration(seconds) * time.Second), nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %s", value)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %s", value)
+	}
+
+	return badoption.Duration(d), nil
+}
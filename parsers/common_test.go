@@ -0,0 +1,103 @@
+package parsers
+
+import (
+	"encoding/base64"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestDecodeRemark(t *testing.T) {
+	tests := []struct {
+		name   string
+		remark string
+		want   string
+	}{
+		{"plain", "USA1", "USA1"},
+		{"plain multiple of 4", "Node1234", "Node1234"},
+		{"plain with spaces", "Germany 01", "Germany 01"},
+		{"plain base64 alphabet", "fast-node_eu", "fast-node_eu"},
+		{"percent-encoded", "Germany%2001", "Germany 01"},
+		{"percent-encoded emoji", "%F0%9F%87%A9%F0%9F%87%AA%20Berlin", "🇩🇪 Berlin"},
+		{"emoji", "🇳🇱 Amsterdam", "🇳🇱 Amsterdam"},
+		{"base64 emoji", base64.StdEncoding.EncodeToString([]byte("🇩🇪 Berlin")), "🇩🇪 Berlin"},
+		{"base64 cyrillic", base64.StdEncoding.EncodeToString([]byte("Москва 1")), "Москва 1"},
+		{"base64 padded ascii", base64.StdEncoding.EncodeToString([]byte("Hello World")), "Hello World"},
+		{"base64url emoji", base64.URLEncoding.EncodeToString([]byte("🇫🇮 Helsinki")), "🇫🇮 Helsinki"},
+		{"percent-encoded base64", "8J%2BHqfCfh6ogQmVybGlu", "🇩🇪 Berlin"},
+	}
+
+	for _, tt := range tests {
+		if got := decodeRemark(tt.remark); got != tt.want {
+			t.Errorf("%s: decodeRemark(%q) = %q, want %q", tt.name, tt.remark, got, tt.want)
+		}
+	}
+}
+
+func TestBuildOutboundMultiplexOptionsProtocol(t *testing.T) {
+	tests := []struct {
+		query    string
+		enabled  bool
+		protocol string
+	}{
+		{"mux=1&mux_protocol=yamux", true, "yamux"},
+		{"mux=1&protocol=h2mux", true, "h2mux"},
+		{"mux=smux", true, "smux"},
+		{"mux=1&mux_protocol=yamux&protocol=h2mux", true, "yamux"},
+		{"protocol=h2mux", false, ""},
+		{"mux=0&protocol=h2mux", false, ""},
+	}
+
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		options, err := buildOutboundMultiplexOptions(query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		if enabled := options != nil && options.Enabled; enabled != tt.enabled {
+			t.Errorf("%s: enabled = %v, want %v", tt.query, enabled, tt.enabled)
+			continue
+		}
+		if options != nil && options.Protocol != tt.protocol {
+			t.Errorf("%s: protocol = %s, want %s", tt.query, options.Protocol, tt.protocol)
+		}
+	}
+
+	query, _ := url.ParseQuery("mux=1&protocol=quic")
+	if _, err := buildOutboundMultiplexOptions(query); err == nil || err.(*ParseError).Field != "protocol" {
+		t.Errorf("mux=1&protocol=quic: want an unsupported protocol error, got %v", err)
+	}
+}
+
+func TestParseDurationParam(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, true},
+		{"30", 30 * time.Second, true},
+		{" 30 ", 30 * time.Second, true},
+		{"1m30s", 90 * time.Second, true},
+		{"-5s", 0, false},
+		{"soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, err := parseDurationParam(tt.value)
+		if (err == nil) != tt.ok || time.Duration(got) != tt.want {
+			t.Errorf("parseDurationParam(%q) = %v, %v; want %v, ok %v", tt.value, time.Duration(got), err, tt.want, tt.ok)
+		}
+	}
+
+	// Both callers report the offending field
+	for uri, field := range map[string]string{
+		"hysteria2://pw@example.com:443?hop_interval=-5s":                 "hop_interval",
+		"anytls://pw@example.com:443?security=tls&idle_session_timeout=x": "idle_session_timeout",
+	} {
+		_, err := ParseProfile(uri)
+		if parseErr, ok := err.(*ParseError); !ok || parseErr.Field != field {
+			t.Errorf("%s: want an error on %s, got %v", uri, field, err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package parsers
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ParseErrorCode is a machine-readable failure reason, stable across hosts and messages
+type ParseErrorCode string
+
+const (
+	CodeEmptyURI         ParseErrorCode = "empty_uri"
+	CodeUnknownScheme    ParseErrorCode = "unknown_scheme"
+	CodeMalformedURI     ParseErrorCode = "malformed_uri"
+	CodeInvalidAddress   ParseErrorCode = "invalid_address"
+	CodeMissingParam     ParseErrorCode = "missing_param"
+	CodeInvalidParam     ParseErrorCode = "invalid_param"
+	CodeUnsupportedParam ParseErrorCode = "unsupported_param"
+	// CodeNeedsRepair marks links ParseProfileStrict refused because utils.TryFixURI had to repair them
+	CodeNeedsRepair ParseErrorCode = "needs_repair"
+	// CodeOther marks errors no parser has classified yet
+	CodeOther ParseErrorCode = "other"
+)
+
+// Parse stages, i.e. which part of a profile was being built
+const (
+	StageURI       = "uri"
+	StageDecode    = "decode"
+	StageTLS       = "tls"
+	StageTransport = "transport"
+	StageMultiplex = "multiplex"
+	StagePlugin    = "plugin"
+	StageOptions   = "options"
+)
+
+// ParseError is returned by ParseProfile. Error() keeps the full "Func: func: ..." chain,
+// the fields allow grouping failures regardless of host or value.
+type ParseError struct {
+	Scheme string
+	Stage  string
+	// Field is the offending share link parameter, if known
+	Field string
+	Code  ParseErrorCode
+	URI   string
+	Err   error
+}
+
+func (e *ParseError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// paramError classifies a failure where it happens. ParseProfile later fills in the scheme
+// and URI and moves the classification to the outermost error.
+func paramError(stage string, field string, code ParseErrorCode, format string, args ...any) error {
+	return &ParseError{
+		Stage: stage,
+		Field: field,
+		Code:  code,
+		Err:   fmt.Errorf(format, args...),
+	}
+}
+
+// classifyError wraps err, which may carry a paramError somewhere in its chain, into a
+// complete ParseError
+func classifyError(scheme string, connURI string, err error) *ParseError {
+	result := &ParseError{
+		Scheme: scheme,
+		Stage:  StageOptions,
+		Code:   CodeOther,
+		URI:    connURI,
+		Err:    err,
+	}
+
+	var inner *ParseError
+	if errors.As(err, &inner) {
+		result.Stage = inner.Stage
+		result.Field = inner.Field
+		result.Code = inner.Code
+	}
+
+	return result
+}
+
+// ParseWarningCode is a machine-readable reason for a ParseWarning
+type ParseWarningCode string
+
+const (
+	// WarnIgnoredParam marks a link parameter sing-box has no equivalent for
+	WarnIgnoredParam ParseWarningCode = "ignored_param"
+	// WarnCoercedValue marks a value that was replaced by the closest supported one
+	WarnCoercedValue ParseWarningCode = "coerced_value"
+	// WarnUnenforced marks a setting that is kept for export but not applied by sing-box
+	WarnUnenforced ParseWarningCode = "unenforced"
+)
+
+// ParseWarning describes a non-fatal issue: the profile works, but not exactly as the link says
+type ParseWarning struct {
+	Field   string
+	Code    ParseWarningCode
+	Message string
+}
+
+func (w ParseWarning) String() string {
+	return string(w.Code) + " " + w.Field + ": " + w.Message
+}
+
+// parseWarnings collects warnings while a profile is being built
+type parseWarnings []ParseWarning
+
+func (w *parseWarnings) add(field string, code ParseWarningCode, format string, args ...any) {
+	*w = append(*w, ParseWarning{
+		Field:   field,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// ignored reports every listed parameter present in the query as ignored
+func (w *parseWarnings) ignored(query url.Values, reason string, fields ...string) {
+	for _, field := range fields {
+		if strings.TrimSpace(query.Get(field)) != "" {
+			w.add(field, WarnIgnoredParam, "%s", reason)
+		}
+	}
+}
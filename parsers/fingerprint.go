@@ -0,0 +1,77 @@
+package parsers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/sagernet/sing-box/include"
+)
+
+// profileIDLength is in hex digits, 64 bits are plenty to keep deduplicated profiles apart
+const profileIDLength = 16
+
+// fingerprintContext is built once, include.Context sets up every protocol registry
+var fingerprintContext = sync.OnceValue(func() context.Context {
+	return include.Context(context.Background())
+})
+
+// Fingerprint identifies the server a profile connects to: type, address, credentials, TLS,
+// transport, every other outbound option and the Hysteria2 pin, but not the tag or the
+// remark. Links that differ only in remark, parameter order or encoding get the same one.
+func (p *ProxyProfile) Fingerprint() (string, error) {
+	c := p.Clone()
+	// Also resets detour tags, which are derived from the main one
+	c.SetTag("")
+
+	data, err := marshalSingBoxProfile(fingerprintContext(), &c)
+	if err != nil {
+		return "", fmt.Errorf("ProxyProfile.Fingerprint: %w", err)
+	}
+
+	// The Hysteria2 pin lives outside the outbound, yet tells otherwise equal links apart
+	if p.PinSHA256 != "" {
+		data += "\npinSHA256=" + p.PinSHA256
+	}
+
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AssignID sets a deterministic ID from the fingerprint and tags the profile with it, so the
+// same server gets the same tag across runs
+func (p *ProxyProfile) AssignID() error {
+	fingerprint, err := p.Fingerprint()
+	if err != nil {
+		return fmt.Errorf("ProxyProfile.AssignID: %w", err)
+	}
+	p.ID = fingerprint[:profileIDLength]
+	p.SetTag(p.ID)
+	return nil
+}
+
+// DeduplicateProfiles keeps the first profile of every fingerprint and counts the dropped
+// ones by Source. Profiles that cannot be fingerprinted are kept.
+func DeduplicateProfiles(profiles []ProxyProfile) ([]ProxyProfile, map[string]int) {
+	seen := make(map[string]struct{}, len(profiles))
+	unique := make([]ProxyProfile, 0, len(profiles))
+	duplicatesBySource := make(map[string]int)
+
+	for _, p := range profiles {
+		fingerprint, err := p.Fingerprint()
+		if err != nil {
+			unique = append(unique, p)
+			continue
+		}
+		if _, exists := seen[fingerprint]; exists {
+			duplicatesBySource[p.Source]++
+			continue
+		}
+		seen[fingerprint] = struct{}{}
+		unique = append(unique, p)
+	}
+
+	return unique, duplicatesBySource
+}
@@ -0,0 +1,69 @@
+package parsers
+
+import "testing"
+
+func TestDeduplicateProfiles(t *testing.T) {
+	const pinA = "ab0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcd"
+	const pinB = "cd0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcd"
+
+	links := []struct {
+		uri    string
+		source string
+	}{
+		{"vless://" + testUUID + "@example.com:443?security=tls&sni=a.com&type=ws&path=%2Fws#one", "a"},
+		// Same server: other remark, parameter order and escaping
+		{"vless://" + testUUID + "@example.com:443?path=/ws&type=ws&sni=a.com&security=tls#two", "b"},
+		{"vless://" + testUUID + "@example.com:443?security=tls&sni=b.com&type=ws&path=%2Fws#other-sni", "a"},
+		{"ss://YWVzLTI1Ni1nY206cGFzcw==@1.2.3.4:8388#padded", "a"},
+		{"ss://YWVzLTI1Ni1nY206cGFzcw@1.2.3.4:8388#unpadded", "a"},
+		{"hysteria2://pw@h.example.com:443?sni=x.com&pinSHA256=" + pinA + "#pin-a", "b"},
+		{"hysteria2://pw@h.example.com:443?sni=x.com&pinSHA256=" + pinB + "#pin-b", "b"},
+		{"hysteria2://pw@h.example.com:443?sni=x.com&pinSHA256=" + pinA + "#pin-a-again", "b"},
+	}
+
+	var profiles []ProxyProfile
+	for _, link := range links {
+		p, err := ParseProfile(link.uri)
+		if err != nil {
+			t.Fatalf("%s: %v", link.uri, err)
+		}
+		p.Source = link.source
+		profiles = append(profiles, *p)
+	}
+
+	unique, duplicatesBySource := DeduplicateProfiles(profiles)
+
+	var names []string
+	for _, p := range unique {
+		names = append(names, p.Name)
+	}
+	want := []string{"one", "other-sni", "padded", "pin-a", "pin-b"}
+	if len(names) != len(want) {
+		t.Fatalf("kept %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("kept %v, want %v", names, want)
+		}
+	}
+
+	if duplicatesBySource["a"] != 1 || duplicatesBySource["b"] != 2 {
+		t.Errorf("duplicates by source = %v, want a:1 b:2", duplicatesBySource)
+	}
+}
+
+func TestAssignIDIsDeterministic(t *testing.T) {
+	const link = "trojan://secret@example.com:443?security=tls&sni=a.com#name"
+
+	first, _ := ParseProfile(link)
+	second, _ := ParseProfile(link)
+	if err := first.AssignID(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.AssignID(); err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == "" || first.ID != second.ID || first.Tag() != first.ID {
+		t.Errorf("IDs %q and %q, tag %q", first.ID, second.ID, first.Tag())
+	}
+}
@@ -0,0 +1,72 @@
+package parsers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bluegradienthorizon/singtoolbox/utils"
+
+	"github.com/sagernet/sing-box/option"
+)
+
+type HTTPParser struct{}
+
+func (p HTTPParser) ParseProfile(connURI string) (*ProxyProfile, error) {
+	connURI, uriFixes, err := utils.TryFixURI(connURI)
+	if err != nil {
+		return nil, paramError(StageURI, "", CodeMalformedURI, "HTTPParser.ParseProfile: %w", err)
+	}
+
+	scheme, _, _ := strings.Cut(connURI, "://")
+	if scheme != "http" && scheme != "https" {
+		return nil, paramError(StageURI, "", CodeUnknownScheme, "HTTPParser.ParseProfile: unsupported scheme %s", scheme)
+	}
+
+	uri, addr, port, err := extractCommonURIData(connURI, scheme)
+	if err != nil {
+		return nil, fmt.Errorf("HTTPParser.ParseProfile: %w", err)
+	}
+
+	if port == 0 {
+		if scheme == "https" {
+			port = 443
+		} else {
+			port = 80
+		}
+	}
+
+	params := uri.Query()
+
+	username, password := extractProxyCredentials(uri.User)
+
+	var TLSOptions *option.OutboundTLSOptions
+	if scheme == "https" {
+		// HTTP CONNECT over TLS
+		TLSOptions = &option.OutboundTLSOptions{
+			Enabled:    true,
+			ServerName: params.Get("sni"),
+			Insecure:   params.Get("insecure") == "1" || params.Get("allowInsecure") == "1",
+		}
+	}
+
+	o := &option.Outbound{
+		Type: "http",
+		Options: &option.HTTPOutboundOptions{
+			ServerOptions: option.ServerOptions{
+				Server:     addr,
+				ServerPort: port,
+			},
+			Username: username,
+			Password: password,
+			OutboundTLSOptionsContainer: option.OutboundTLSOptionsContainer{
+				TLS: TLSOptions,
+			},
+		},
+	}
+
+	return &ProxyProfile{
+		Outbound: o,
+		ConnURI:  connURI,
+		URIFixes: uriFixes,
+	}, nil
+}
@@ -0,0 +1,118 @@
+package parsers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bluegradienthorizon/singtoolbox/utils"
+
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/json/badoption"
+)
+
+type HysteriaParser struct{}
+
+func (p HysteriaParser) ParseProfile(connURI string) (*ProxyProfile, error) {
+	connURI, uriFixes, err := utils.TryFixURI(connURI)
+	if err != nil {
+		return nil, paramError(StageURI, "", CodeMalformedURI, "HysteriaParser.ParseProfile: %w", err)
+	}
+
+	uri, addr, port, err := extractCommonURIData(connURI, "hysteria")
+	if err != nil {
+		return nil, fmt.Errorf("HysteriaParser.ParseProfile: %w", err)
+	}
+
+	params := uri.Query()
+
+	protocol := params.Get("protocol")
+	auth := params.Get("auth")
+	peer := params.Get("peer")
+	sni := params.Get("sni")
+	alpn := params.Get("alpn")
+	insecure := params.Get("insecure") == "1" || params.Get("allowInsecure") == "1"
+	obfsType := params.Get("obfs")
+	obfsParam := params.Get("obfsParam")
+
+	if protocol != "" && protocol != "udp" {
+		return nil, paramError(StageOptions, "protocol", CodeUnsupportedParam, "HysteriaParser.ParseProfile: unsupported protocol %s", protocol)
+	}
+
+	if obfsType != "" && obfsType != "xplus" {
+		return nil, paramError(StageOptions, "obfs", CodeUnsupportedParam, "HysteriaParser.ParseProfile: unsupported obfs %s", obfsType)
+	}
+
+	upMbps, err := parseHysteriaMbps(params.Get("upmbps"))
+	if err != nil {
+		return nil, paramError(StageOptions, "upmbps", CodeInvalidParam, "HysteriaParser.ParseProfile: upmbps: %w", err)
+	}
+
+	downMbps, err := parseHysteriaMbps(params.Get("downmbps"))
+	if err != nil {
+		return nil, paramError(StageOptions, "downmbps", CodeInvalidParam, "HysteriaParser.ParseProfile: downmbps: %w", err)
+	}
+
+	if auth == "" && uri.User != nil {
+		auth = uri.User.Username()
+	}
+
+	if peer == "" {
+		peer = sni
+	}
+
+	TLSOptions := &option.OutboundTLSOptions{
+		Enabled:    true,
+		ServerName: peer,
+		Insecure:   insecure,
+	}
+
+	// sing-quic falls back to the "hysteria" ALPN when none is set
+	if alpn != "" {
+		TLSOptions.ALPN = badoption.Listable[string]{}
+		for _, val := range strings.Split(alpn, ",") {
+			TLSOptions.ALPN = append(TLSOptions.ALPN, val)
+		}
+	}
+
+	o := &option.Outbound{
+		Type: "hysteria",
+		Options: &option.HysteriaOutboundOptions{
+			ServerOptions: option.ServerOptions{
+				Server:     addr,
+				ServerPort: port,
+			},
+			UpMbps:     upMbps,
+			DownMbps:   downMbps,
+			Obfs:       obfsParam,
+			AuthString: auth,
+			OutboundTLSOptionsContainer: option.OutboundTLSOptionsContainer{
+				TLS: TLSOptions,
+			},
+		},
+	}
+
+	return &ProxyProfile{
+		Outbound: o,
+		ConnURI:  connURI,
+		URIFixes: uriFixes,
+	}, nil
+}
+
+// Bandwidth is mandatory for Hysteria v1 clients, sing-quic refuses to start without it
+func parseHysteriaMbps(mbps string) (int, error) {
+	if mbps == "" {
+		return 0, errors.New("missing value")
+	}
+
+	val, err := strconv.Atoi(strings.TrimSpace(mbps))
+	if err != nil {
+		return 0, errors.New("invalid value " + mbps)
+	}
+	if val <= 0 {
+		return 0, errors.New("value must be positive")
+	}
+
+	return val, nil
+}
@@ -1,53 +1,108 @@
 package parsers
 
 import (
-	"errors"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bluegradienthorizon/singtoolbox/utils"
 
 	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/json/badoption"
 )
 
+// hysteria2PortsRegexp matches a multi-port authority such as "host:443,20000-30000"
+var hysteria2PortsRegexp = regexp.MustCompile(`^([^/?#]*@)?(\[[^\]/?#]*\]|[^:/?#]*):(\d+(?:-\d+)?(?:,\d+(?:-\d+)?)+|\d+-\d+)`)
+
+var bandwidthRegexp = regexp.MustCompile(`^(\d+(?:\.\d+)?)([kmgt]?)(?:bps|b)?$`)
+
 type Hysteria2Parser struct{}
 
 func (p Hysteria2Parser) ParseProfile(connURI string) (*ProxyProfile, error) {
-	connURI, err := utils.TryFixURI(connURI)
+	connURI, uriFixes, err := utils.TryFixURI(connURI)
 	if err != nil {
-		return nil, errors.New("Hysteria2Parser.ParseProfile: "+err.Error())
+		return nil, paramError(StageURI, "", CodeMalformedURI, "Hysteria2Parser.ParseProfile: %w", err)
 	}
 
-	uri, addr, port, err := extractCommonURIData(connURI, "vless")
+	singlePortURI, hostPorts := splitHysteria2Ports(connURI)
+
+	uri, addr, port, err := extractCommonURIData(singlePortURI, "hysteria2")
 	if err != nil {
-		return nil, errors.New("Hysteria2Parser.ParseProfile: "+err.Error())
+		return nil, fmt.Errorf("Hysteria2Parser.ParseProfile: %w", err)
 	}
 
 	params := uri.Query()
 
 	sni := params.Get("sni")
 	insecure := params.Get("insecure") == "1"
-	// pinSHA256 := params.Get("pinSHA256")
 	obfsType := params.Get("obfs")
 	salamanderPassword := params.Get("obfs-password")
 	password := uri.User.Username()
 
+	var warnings parseWarnings
+
 	var obfs *option.Hysteria2Obfs
 	if obfsType != "" && salamanderPassword != "" {
 		obfs = &option.Hysteria2Obfs{
 			Type:     obfsType,
 			Password: salamanderPassword,
 		}
+	} else if obfsType != "" {
+		warnings.add("obfs", WarnIgnoredParam, "obfs %s without obfs-password", obfsType)
+	}
+
+	pin, err := normalizePinSHA256(params.Get("pinSHA256"))
+	if err != nil {
+		return nil, fmt.Errorf("Hysteria2Parser.ParseProfile: %w", err)
+	}
+	// Links used to get insecure forced on without an sni, which let pinned self-signed servers
+	// through. Now they are verified against the sni or the address and fail unless insecure=1.
+	if pin != "" && insecure {
+		warnings.add("pinSHA256", WarnUnenforced, "sing-box cannot pin certificates and insecure=1 is set, so the certificate is not verified at all; the pin is only kept for export")
+	} else if pin != "" {
+		verifyName := sni
+		if verifyName == "" {
+			verifyName = addr
+		}
+		warnings.add("pinSHA256", WarnUnenforced, "sing-box cannot pin certificates, so the certificate is verified against %s instead; "+
+			"a pinned self-signed server will fail TLS verification unless insecure=1 is added", verifyName)
+	}
+
+	// Hop ports from the authority take precedence over the mport parameter
+	if hostPorts == "" {
+		hostPorts = params.Get("mport")
+	}
+	serverPorts, err := parseHysteria2Ports(hostPorts)
+	if err != nil {
+		return nil, fmt.Errorf("Hysteria2Parser.ParseProfile: %w", err)
+	}
+
+	hopInterval, err := parseDurationParam(firstParam(params, "hop_interval", "hop-interval", "hopInterval"))
+	if err != nil {
+		return nil, paramError(StageOptions, "hop_interval", CodeInvalidParam, "Hysteria2Parser.ParseProfile: hop_interval: %w", err)
+	}
+
+	upMbps, err := parseBandwidthMbps(firstParam(params, "up", "upmbps"))
+	if err != nil {
+		return nil, paramError(StageOptions, "up", CodeInvalidParam, "Hysteria2Parser.ParseProfile: up: %w", err)
+	}
+	downMbps, err := parseBandwidthMbps(firstParam(params, "down", "downmbps"))
+	if err != nil {
+		return nil, paramError(StageOptions, "down", CodeInvalidParam, "Hysteria2Parser.ParseProfile: down: %w", err)
 	}
 
+	// An empty sni makes sing-box verify against the server address
 	TLSOptions := &option.OutboundTLSOptions{
 		Enabled:    true,
 		ServerName: sni,
 		Insecure:   insecure,
 	}
 
-	if sni == "" {
-		TLSOptions.Insecure = true
-	}
-
 	o := &option.Outbound{
 		Type: "hysteria2",
 		Options: &option.Hysteria2OutboundOptions{
@@ -55,7 +110,11 @@ func (p Hysteria2Parser) ParseProfile(connURI string) (*ProxyProfile, error) {
 				Server:     addr,
 				ServerPort: port,
 			},
-			Obfs: obfs,
+			ServerPorts: serverPorts,
+			HopInterval: hopInterval,
+			UpMbps:      upMbps,
+			DownMbps:    downMbps,
+			Obfs:        obfs,
 			OutboundTLSOptionsContainer: option.OutboundTLSOptionsContainer{
 				TLS: TLSOptions,
 			},
@@ -64,7 +123,158 @@ func (p Hysteria2Parser) ParseProfile(connURI string) (*ProxyProfile, error) {
 	}
 
 	return &ProxyProfile{
-		Outbound: o,
-		ConnURI:  connURI,
+		Outbound:  o,
+		ConnURI:   connURI,
+		PinSHA256: pin,
+		Warnings:  warnings,
+		URIFixes:  uriFixes,
 	}, nil
 }
+
+// splitHysteria2Ports replaces a multi-port authority with its first port, which url.Parse
+// accepts, and returns the port list separately
+func splitHysteria2Ports(connURI string) (string, string) {
+	scheme, rest, ok := strings.Cut(connURI, "://")
+	if !ok {
+		return connURI, ""
+	}
+
+	match := hysteria2PortsRegexp.FindStringSubmatchIndex(rest)
+	if match == nil {
+		return connURI, ""
+	}
+
+	ports := rest[match[6]:match[7]]
+	first := strings.FieldsFunc(ports, func(r rune) bool { return r == ',' || r == '-' })[0]
+	return scheme + "://" + rest[:match[6]] + first + rest[match[7]:], ports
+}
+
+// parseHysteria2Ports converts "443,20000-30000" into sing-box server_ports, which only takes
+// ranges ("443:443", "20000:30000")
+func parseHysteria2Ports(ports string) (badoption.Listable[string], error) {
+	var result badoption.Listable[string]
+	for _, part := range strings.Split(ports, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		startStr, endStr, isRange := strings.Cut(part, "-")
+		start, err := strconv.ParseUint(startStr, 10, 16)
+		if err != nil || start == 0 {
+			return nil, paramError(StageOptions, "mport", CodeInvalidParam, "parseHysteria2Ports: invalid port %s", part)
+		}
+		if !isRange {
+			endStr = startStr
+		}
+
+		end, err := strconv.ParseUint(endStr, 10, 16)
+		if err != nil || end < start {
+			return nil, paramError(StageOptions, "mport", CodeInvalidParam, "parseHysteria2Ports: invalid port range %s", part)
+		}
+		result = append(result, startStr+":"+endStr)
+	}
+	return result, nil
+}
+
+// parseBandwidthMbps accepts "100", "100 mbps", "1gbps" and the like. A bare number means Mbps,
+// as in Clash configs and most share links.
+func parseBandwidthMbps(value string) (int, error) {
+	value = strings.ToLower(strings.ReplaceAll(value, " ", ""))
+	if value == "" {
+		return 0, nil
+	}
+
+	match := bandwidthRegexp.FindStringSubmatch(value)
+	if match == nil {
+		return 0, fmt.Errorf("parseBandwidthMbps: invalid bandwidth %s", value)
+	}
+	n, _ := strconv.ParseFloat(match[1], 64)
+	switch match[2] {
+	case "k":
+		n /= 1000
+	case "g":
+		n *= 1000
+	case "t":
+		n *= 1000 * 1000
+	}
+
+	if n > 0 && n < 1 {
+		return 1, nil
+	}
+	if n > math.MaxInt32 {
+		return 0, fmt.Errorf("parseBandwidthMbps: bandwidth %s out of range", value)
+	}
+	return int(math.Round(n)), nil
+}
+
+// normalizePinSHA256 accepts the hex certificate hash with or without ':' separators
+func normalizePinSHA256(pin string) (string, error) {
+	if pin == "" {
+		return "", nil
+	}
+	normalized := strings.ToLower(strings.NewReplacer(":", "", "-", "", " ", "").Replace(pin))
+	if b, err := hex.DecodeString(normalized); err != nil || len(b) != 32 {
+		return "", paramError(StageTLS, "pinSHA256", CodeInvalidParam, "normalizePinSHA256: invalid pinSHA256 %s", pin)
+	}
+	return normalized, nil
+}
+
+func formatHysteria2Profile(o *option.Hysteria2OutboundOptions, pin string, remark string) (string, error) {
+	query := url.Values{}
+
+	if o.TLS != nil {
+		if o.TLS.ServerName != "" {
+			query.Set("sni", o.TLS.ServerName)
+		}
+		if o.TLS.Insecure {
+			query.Set("insecure", "1")
+		}
+	}
+	if pin != "" {
+		query.Set("pinSHA256", pin)
+	}
+
+	if o.Obfs != nil && o.Obfs.Type != "" {
+		query.Set("obfs", o.Obfs.Type)
+		query.Set("obfs-password", o.Obfs.Password)
+	}
+
+	if len(o.ServerPorts) > 0 {
+		query.Set("mport", FormatHysteria2Ports(o.ServerPorts))
+	}
+	if o.HopInterval > 0 {
+		query.Set("hop_interval", time.Duration(o.HopInterval).String())
+	}
+	if o.UpMbps > 0 {
+		query.Set("up", strconv.Itoa(o.UpMbps))
+	}
+	if o.DownMbps > 0 {
+		query.Set("down", strconv.Itoa(o.DownMbps))
+	}
+
+	u := &url.URL{
+		Scheme:   "hysteria2",
+		User:     url.User(o.Password),
+		Host:     formatServerHost(o.ServerOptions),
+		RawQuery: query.Encode(),
+		Fragment: remark,
+	}
+
+	return u.String(), nil
+}
+
+// FormatHysteria2Ports is the inverse of parseHysteria2Ports: sing-box server_ports
+// ("443:443", "20000:30000") become "443,20000-30000", as in share links and Clash configs
+func FormatHysteria2Ports(ports badoption.Listable[string]) string {
+	parts := make([]string, 0, len(ports))
+	for _, p := range ports {
+		start, end, _ := strings.Cut(p, ":")
+		if start == end {
+			parts = append(parts, start)
+		} else {
+			parts = append(parts, start+"-"+end)
+		}
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,40 @@
+package parsers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sagernet/sing-box/option"
+)
+
+func TestHysteria2ParserPinWithoutSNI(t *testing.T) {
+	const pin = "ab0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcd"
+
+	tests := []struct {
+		uri      string
+		insecure bool
+		warning  string
+	}{
+		{"hysteria2://pw@203.0.113.7:443?pinSHA256=" + pin, false, "verified against 203.0.113.7"},
+		{"hysteria2://pw@203.0.113.7:443?sni=h.example.com&pinSHA256=" + pin, false, "verified against h.example.com"},
+		{"hysteria2://pw@203.0.113.7:443?insecure=1&pinSHA256=" + pin, true, "not verified at all"},
+	}
+
+	for _, tt := range tests {
+		p, err := ParseProfile(tt.uri)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.uri, err)
+		}
+		o := p.Outbound.Options.(*option.Hysteria2OutboundOptions)
+		// The pin is never turned into insecure, which would accept any certificate
+		if o.TLS.Insecure != tt.insecure {
+			t.Errorf("%s: insecure = %v, want %v", tt.uri, o.TLS.Insecure, tt.insecure)
+		}
+		if p.PinSHA256 != pin {
+			t.Errorf("%s: pin not kept for export", tt.uri)
+		}
+		if len(p.Warnings) != 1 || p.Warnings[0].Code != WarnUnenforced || !strings.Contains(p.Warnings[0].Message, tt.warning) {
+			t.Errorf("%s: warnings = %v, want one mentioning %q", tt.uri, p.Warnings, tt.warning)
+		}
+	}
+}
@@ -3,44 +3,330 @@ package parsers
 import (
 	"errors"
 	"fmt"
+	"maps"
+	"reflect"
 	"strings"
 
+	"github.com/bluegradienthorizon/singtoolbox/utils"
+
 	"github.com/sagernet/sing-box/option"
 )
 
+// ProxyProfile holds either an outbound or an endpoint (e.g. WireGuard), never both.
+// Detours are auxiliary outbounds the main outbound dials through (e.g. ShadowTLS).
 type ProxyProfile struct {
 	Outbound *option.Outbound
+	Endpoint *option.Endpoint
+	Detours  []option.Outbound
 	ConnURI  string
+	// ID is derived from the fingerprint by AssignID and doubles as the tag
+	ID string
+
+	// Name is the decoded remark of the share link (or the tag in JSON configs)
+	Name string
+	// Source is the subscription link or file the profile was loaded from
+	Source string
+	// Labels are free-form attributes (e.g. "country", "delay") usable in name templates
+	Labels map[string]string
+	// Warnings are non-fatal parse issues, e.g. link parameters sing-box has no equivalent for
+	Warnings []ParseWarning
+	// PinSHA256 is the pinned server certificate hash (lowercase hex) from a Hysteria2 link.
+	// sing-box has no pinning option, so it is only carried through export.
+	PinSHA256 string
+	// URIFixes are the rewrites utils.TryFixURI applied to the share link, in order
+	URIFixes []utils.URIFix
+	// Repaired is set when one of the URIFixes repaired a broken link, not just decoded it
+	Repaired bool
+}
+
+func (p *ProxyProfile) Type() string {
+	if p.Endpoint != nil {
+		return p.Endpoint.Type
+	}
+	return p.Outbound.Type
+}
+
+func (p *ProxyProfile) Tag() string {
+	if p.Endpoint != nil {
+		return p.Endpoint.Tag
+	}
+	return p.Outbound.Tag
+}
+
+func (p *ProxyProfile) SetTag(tag string) {
+	if p.Endpoint != nil {
+		p.Endpoint.Tag = tag
+		return
+	}
+	p.Outbound.Tag = tag
+
+	// Detour tags must stay unique across profiles, so derive them from the main tag
+	for i := range p.Detours {
+		oldTag := p.Detours[i].Tag
+		newTag := fmt.Sprintf("%s-detour-%d", tag, i)
+		p.Detours[i].Tag = newTag
+		replaceDetour(p.Outbound, oldTag, newTag)
+		for j := range p.Detours {
+			replaceDetour(&p.Detours[j], oldTag, newTag)
+		}
+	}
+}
+
+func (p *ProxyProfile) SetLabel(key string, value string) {
+	if p.Labels == nil {
+		p.Labels = make(map[string]string)
+	}
+	p.Labels[key] = value
+}
+
+// SetMultiplexEnabled forces multiplexing on or off. Mux settings from the link are kept when
+// turning it on. It reports false for outbound types without multiplex support.
+func (p *ProxyProfile) SetMultiplexEnabled(enabled bool) bool {
+	if p.Outbound == nil {
+		return false
+	}
+
+	var multiplex **option.OutboundMultiplexOptions
+	switch o := p.Outbound.Options.(type) {
+	case *option.VLESSOutboundOptions:
+		multiplex = &o.Multiplex
+	case *option.VMessOutboundOptions:
+		multiplex = &o.Multiplex
+	case *option.TrojanOutboundOptions:
+		multiplex = &o.Multiplex
+	case *option.ShadowsocksOutboundOptions:
+		multiplex = &o.Multiplex
+	default:
+		return false
+	}
+
+	switch {
+	case !enabled:
+		*multiplex = nil
+	case *multiplex == nil:
+		*multiplex = &option.OutboundMultiplexOptions{Enabled: true}
+	default:
+		(*multiplex).Enabled = true
+	}
+	return true
+}
+
+// SetTLSFragment switches ClientHello fragmentation on or off. It reports false when there is
+// nothing to fragment: no TLS, REALITY or a QUIC-based protocol.
+func (p *ProxyProfile) SetTLSFragment(enabled bool) bool {
+	if p.Outbound == nil {
+		return false
+	}
+	switch p.Outbound.Type {
+	case "hysteria", "hysteria2", "tuic":
+		return false
+	}
+
+	wrapper, ok := p.Outbound.Options.(option.OutboundTLSOptionsWrapper)
+	if !ok {
+		return false
+	}
+	tls := wrapper.TakeOutboundTLSOptions()
+	if tls == nil || !tls.Enabled || (tls.Reality != nil && tls.Reality.Enabled) {
+		return false
+	}
+
+	// TLS options are shared with clones, so replace them instead of editing in place
+	updated := *tls
+	updated.Fragment = enabled
+	// sing-box 1.12 only wraps the connection when record fragmentation is on as well
+	updated.RecordFragment = enabled
+	wrapper.ReplaceOutboundTLSOptions(&updated)
+	return true
+}
+
+// Clone copies the profile deep enough that SetTag on the copy leaves the original untouched
+func (p *ProxyProfile) Clone() ProxyProfile {
+	c := *p
+	if p.Outbound != nil {
+		o := cloneOutbound(*p.Outbound)
+		c.Outbound = &o
+	}
+	if p.Endpoint != nil {
+		e := *p.Endpoint
+		c.Endpoint = &e
+	}
+	c.Detours = nil
+	for _, d := range p.Detours {
+		c.Detours = append(c.Detours, cloneOutbound(d))
+	}
+	c.Labels = maps.Clone(p.Labels)
+	return c
+}
+
+// cloneOutbound copies the options struct, which holds the dialer detour
+func cloneOutbound(o option.Outbound) option.Outbound {
+	v := reflect.ValueOf(o.Options)
+	if v.Kind() == reflect.Pointer && !v.IsNil() {
+		c := reflect.New(v.Elem().Type())
+		c.Elem().Set(v.Elem())
+		o.Options = c.Interface()
+	}
+	return o
+}
+
+func replaceDetour(o *option.Outbound, oldTag string, newTag string) {
+	wrapper, ok := o.Options.(option.DialerOptionsWrapper)
+	if !ok {
+		return
+	}
+	dialerOptions := wrapper.TakeDialerOptions()
+	if dialerOptions.Detour == oldTag {
+		dialerOptions.Detour = newTag
+		wrapper.ReplaceDialerOptions(dialerOptions)
+	}
 }
 
 type ProfileParser interface {
 	ParseProfile(string) (*ProxyProfile, error)
 }
 
+// ParseProfile parses a share link or a single-line sing-box JSON profile.
+// Errors are always *ParseError.
 func ParseProfile(connURI string) (*ProxyProfile, error) {
 	connURI = strings.TrimSpace(connURI)
 	if connURI == "" {
-		return nil, errors.New("ParseProfile: empty configuration URI")
+		return nil, &ParseError{
+			Stage: StageURI,
+			Code:  CodeEmptyURI,
+			Err:   errors.New("ParseProfile: empty configuration URI"),
+		}
 	}
 
-	splitURI := strings.Split(connURI, "://")
+	// Profiles imported from sing-box configs are stored as single-line JSON
+	if strings.HasPrefix(connURI, "{") {
+		profile, err := SingBoxParser{}.ParseProfile(connURI)
+		if err != nil {
+			return nil, classifyError("sing-box", connURI, fmt.Errorf("ParseProfile: %w", err))
+		}
+		fillProfileName(profile, connURI)
+		return profile, nil
+	}
 
-	parsers := map[string]ProfileParser{
-		"vless":     VLESSParser{},
-		"trojan":    TrojanParser{},
-		"vmess":     VMessParser{},
-		"ss":        ShadowsocksParser{},
-		"hysteria2": Hysteria2Parser{},
-		"hy2":       Hysteria2Parser{},
+	rawScheme, rest, found := strings.Cut(connURI, "://")
+	if !found {
+		return nil, &ParseError{
+			Stage: StageURI,
+			Code:  CodeMalformedURI,
+			URI:   connURI,
+			Err:   errors.New("ParseProfile: missing URI scheme"),
+		}
 	}
+	// Parsers match the scheme literally, so hand them a lowercase one
+	scheme := strings.ToLower(rawScheme)
+	connURI = scheme + "://" + rest
 
-	if parser, ok := parsers[splitURI[0]]; ok {
-		profile, err := parser.ParseProfile(connURI)
-		if err != nil {
-			return nil, errors.New("ParseProfile: " + err.Error())
+	parser, ok := LookupParser(scheme)
+	if !ok {
+		return nil, &ParseError{
+			Scheme: scheme,
+			Stage:  StageURI,
+			Code:   CodeUnknownScheme,
+			URI:    connURI,
+			Err:    fmt.Errorf("ParseProfile: unknown profile URI scheme %s", scheme),
 		}
+	}
+
+	profile, err := parser.ParseProfile(connURI)
+	if err != nil {
+		return nil, classifyError(scheme, connURI, fmt.Errorf("ParseProfile: %w", err))
+	}
+	profile.Repaired = utils.NeedsRepair(profile.URIFixes)
+	fillProfileName(profile, connURI)
+	return profile, nil
+}
+
+// ParseProfileStrict is ParseProfile that refuses links utils.TryFixURI had to repair
+// instead of guessing what they meant. The decoding every link goes through is allowed,
+// so canonical FormatProfile output always passes.
+func ParseProfileStrict(connURI string) (*ProxyProfile, error) {
+	profile, err := ParseProfile(connURI)
+	if err != nil {
+		return nil, err
+	}
+	if !profile.Repaired {
 		return profile, nil
-	} else {
-		return nil, fmt.Errorf("ParseProfile: unknown profile URI scheme %s", splitURI[0])
 	}
+
+	var repairs []string
+	for _, fix := range profile.URIFixes {
+		if fix.IsRepair() {
+			repairs = append(repairs, string(fix))
+		}
+	}
+
+	connURI = strings.TrimSpace(connURI)
+	scheme, _, _ := strings.Cut(connURI, "://")
+	return nil, &ParseError{
+		Scheme: strings.ToLower(scheme),
+		Stage:  StageURI,
+		Code:   CodeNeedsRepair,
+		URI:    connURI,
+		Err:    fmt.Errorf("ParseProfileStrict: URI needs repair: %s", strings.Join(repairs, ", ")),
+	}
+}
+
+// FormatProfile serializes a profile back into a share URI accepted by ParseProfile.
+// Options that the share link format cannot express (e.g. dialer settings) are dropped.
+func FormatProfile(p *ProxyProfile) (string, error) {
+	if p.Endpoint != nil {
+		return "", fmt.Errorf("FormatProfile: unsupported endpoint type %s", p.Endpoint.Type)
+	}
+	if p.Outbound == nil {
+		return "", errors.New("FormatProfile: empty profile")
+	}
+
+	remark := p.Name
+
+	var connURI string
+	var err error
+
+	switch o := p.Outbound.Options.(type) {
+	case *option.VLESSOutboundOptions:
+		connURI, err = formatVLESSProfile(o, remark)
+	case *option.VMessOutboundOptions:
+		connURI, err = formatVMessProfile(o, remark)
+	case *option.TrojanOutboundOptions:
+		connURI, err = formatTrojanProfile(o, remark)
+	case *option.ShadowsocksOutboundOptions:
+		connURI, err = formatShadowsocksProfile(o, p.Detours, remark)
+	case *option.Hysteria2OutboundOptions:
+		connURI, err = formatHysteria2Profile(o, p.PinSHA256, remark)
+	default:
+		return "", fmt.Errorf("FormatProfile: unsupported outbound type %s", p.Outbound.Type)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("FormatProfile: %w", err)
+	}
+
+	return connURI, nil
+}
+
+// fillProfileName takes the name from the URI remark unless the parser found one itself
+// (e.g. vmess "ps"), and derives the country label from a flag emoji in it
+func fillProfileName(p *ProxyProfile, connURI string) {
+	if p.Name == "" {
+		p.Name = decodeRemark(profileRemark(connURI))
+	}
+	if country := countryFromFlag(p.Name); country != "" {
+		p.SetLabel("country", country)
+	}
+}
+
+// profileRemark returns the fragment of a share URI, if any
+func profileRemark(connURI string) string {
+	if strings.HasPrefix(connURI, "{") {
+		return ""
+	}
+	index := strings.LastIndex(connURI, "#")
+	if index == -1 {
+		return ""
+	}
+	return connURI[index+1:]
 }
@@ -0,0 +1,101 @@
+package parsers
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	registryMu    sync.RWMutex
+	parserByName  = make(map[string]ProfileParser)
+	schemeAliases = make(map[string]string)
+)
+
+func init() {
+	RegisterParser("vless", VLESSParser{})
+	RegisterParser("trojan", TrojanParser{})
+	RegisterParser("vmess", VMessParser{})
+	RegisterParser("ss", ShadowsocksParser{})
+	RegisterParser("hysteria2", Hysteria2Parser{})
+	RegisterParser("hysteria", HysteriaParser{})
+	RegisterParser("tuic", TUICParser{})
+	RegisterParser("wireguard", WireGuardParser{})
+	// The SOCKS and HTTP parsers read the version or TLS from the scheme itself
+	RegisterParser("socks", SOCKSParser{})
+	RegisterParser("socks4", SOCKSParser{})
+	RegisterParser("socks4a", SOCKSParser{})
+	RegisterParser("http", HTTPParser{})
+	RegisterParser("https", HTTPParser{})
+	RegisterParser("ssh", SSHParser{})
+	RegisterParser("anytls", AnyTLSParser{})
+
+	RegisterAlias("hy2", "hysteria2")
+	RegisterAlias("wg", "wireguard")
+	RegisterAlias("socks5", "socks")
+	RegisterAlias("socks5h", "socks")
+}
+
+// RegisterParser adds a parser for a share link scheme, replacing any parser (or alias)
+// registered under that name. Schemes are case-insensitive.
+func RegisterParser(scheme string, parser ProfileParser) {
+	scheme = strings.ToLower(scheme)
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	delete(schemeAliases, scheme)
+	parserByName[scheme] = parser
+}
+
+// RegisterAlias makes alias resolve to the parser of scheme, including a parser
+// registered for scheme later on
+func RegisterAlias(alias string, scheme string) {
+	alias = strings.ToLower(alias)
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	delete(parserByName, alias)
+	schemeAliases[alias] = strings.ToLower(scheme)
+}
+
+// LookupParser returns the parser for a scheme or one of its aliases
+func LookupParser(scheme string) (ProfileParser, bool) {
+	scheme = strings.ToLower(scheme)
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	if target, ok := schemeAliases[scheme]; ok {
+		scheme = target
+	}
+	parser, ok := parserByName[scheme]
+	return parser, ok
+}
+
+// SupportedSchemes lists the registered schemes, without aliases, sorted
+func SupportedSchemes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	return slices.Sorted(maps.Keys(parserByName))
+}
+
+// SchemeAliases lists the aliases of a scheme, sorted
+func SchemeAliases(scheme string) []string {
+	scheme = strings.ToLower(scheme)
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	var aliases []string
+	for alias, target := range schemeAliases {
+		if target == scheme {
+			aliases = append(aliases, alias)
+		}
+	}
+	slices.Sort(aliases)
+	return aliases
+}
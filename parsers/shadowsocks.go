@@ -2,7 +2,8 @@ package parsers
 
 import (
 	"encoding/base64"
-	"errors"
+	"fmt"
+	"net/url"
 	"strings"
 
 	"github.com/bluegradienthorizon/singtoolbox/utils"
@@ -13,22 +14,27 @@ import (
 type ShadowsocksParser struct{}
 
 func (p ShadowsocksParser) ParseProfile(connURI string) (*ProxyProfile, error) {
-	connURI, err := utils.TryFixURI(connURI)
+	connURI, uriFixes, err := utils.TryFixURI(connURI)
 	if err != nil {
-		return nil, errors.New("ShadowsocksParser.ParseProfile: " + err.Error())
+		return nil, paramError(StageURI, "", CodeMalformedURI, "ShadowsocksParser.ParseProfile: %w", err)
 	}
 
+	connURI = escapeShadowsocksUserInfo(connURI)
+
 	uri, addr, port, err := extractCommonURIData(connURI, "shadowsocks")
 	if err != nil {
-		return nil, errors.New("ShadowsocksParser.ParseProfile: " + err.Error())
+		return nil, fmt.Errorf("ShadowsocksParser.ParseProfile: %w", err)
 	}
 
 	decodedHostBytes, err := base64.StdEncoding.DecodeString(uri.Host)
 	if err == nil {
 		decodedHost := string(decodedHostBytes)
+		if uri.RawQuery != "" && !strings.Contains(decodedHost, "?") {
+			decodedHost += "?" + uri.RawQuery
+		}
 		uri, addr, port, err = extractCommonURIData("ss://"+decodedHost+"#"+uri.RawFragment, "shadowsocks")
 		if err != nil {
-			return nil, errors.New("ShadowsocksParser.ParseProfile: " + err.Error())
+			return nil, fmt.Errorf("ShadowsocksParser.ParseProfile: %w", err)
 		}
 	}
 
@@ -36,18 +42,21 @@ func (p ShadowsocksParser) ParseProfile(connURI string) (*ProxyProfile, error) {
 
 	var method, password string
 
-	authPart := uri.User.String()
-	uriPassword, _ := uri.User.Password()
+	// TryFixURI escapes the whole userinfo, so plain "method:password" ends up in the username
+	authPart := uri.User.Username()
+	uriPassword, hasPassword := uri.User.Password()
+	if hasPassword {
+		authPart += ":" + uriPassword
+	}
 
 	if !strings.Contains(authPart, ":") && uriPassword == "" {
-		userPart := uri.User.String()
-		decodedAuthBytes, err := base64.StdEncoding.DecodeString(userPart)
+		decodedAuthBytes, err := decodeBase64Lenient(authPart)
 		if err == nil {
 			decodedAuth := string(decodedAuthBytes)
 			if strings.Count(decodedAuth, ":") > 0 {
 				method, password, _ = strings.Cut(decodedAuth, ":")
 			} else {
-				return nil, errors.New("ShadowsocksParser.ParseProfile: malformed base64 encoded user:pass tuple")
+				return nil, paramError(StageDecode, "userinfo", CodeMalformedURI, "ShadowsocksParser.ParseProfile: malformed base64 encoded user:pass tuple")
 			}
 		}
 	}
@@ -64,20 +73,134 @@ func (p ShadowsocksParser) ParseProfile(connURI string) (*ProxyProfile, error) {
 		}
 	}
 
-	o := &option.Outbound{
-		Type: "shadowsocks",
-		Options: &option.ShadowsocksOutboundOptions{
-			ServerOptions: option.ServerOptions{
-				Server:     addr,
-				ServerPort: port,
-			},
-			Method:   method,
-			Password: password,
+	if strings.HasPrefix(method, "2022-") {
+		password, err = normalizeShadowsocks2022Password(method, password)
+		if err != nil {
+			return nil, fmt.Errorf("ShadowsocksParser.ParseProfile: %w", err)
+		}
+	}
+
+	multiplexOptions, err := buildOutboundMultiplexOptions(params)
+	if err != nil {
+		return nil, fmt.Errorf("ShadowsocksParser.ParseProfile: %w", err)
+	}
+
+	ssOptions := &option.ShadowsocksOutboundOptions{
+		ServerOptions: option.ServerOptions{
+			Server:     addr,
+			ServerPort: port,
 		},
+		Method:    method,
+		Password:  password,
+		Multiplex: multiplexOptions,
+	}
+
+	plugin, err := extractRawQueryParam(uri.RawQuery, "plugin")
+	if err != nil {
+		return nil, fmt.Errorf("ShadowsocksParser.ParseProfile: %w", err)
+	}
+
+	detours, err := applySIP003Plugin(plugin, ssOptions)
+	if err != nil {
+		return nil, fmt.Errorf("ShadowsocksParser.ParseProfile: %w", err)
+	}
+
+	o := &option.Outbound{
+		Type:    "shadowsocks",
+		Options: ssOptions,
 	}
 
 	return &ProxyProfile{
 		Outbound: o,
+		Detours:  detours,
 		ConnURI:  connURI,
+		URIFixes: uriFixes,
 	}, nil
 }
+
+var shadowsocks2022KeyLengths = map[string]int{
+	"2022-blake3-aes-128-gcm":       16,
+	"2022-blake3-aes-256-gcm":       32,
+	"2022-blake3-chacha20-poly1305": 32,
+}
+
+// normalizeShadowsocks2022Password checks every PSK of "[iPSK:...]uPSK" against the
+// key length of the method and re-encodes them as padded standard base64
+func normalizeShadowsocks2022Password(method string, password string) (string, error) {
+	keyLength, ok := shadowsocks2022KeyLengths[method]
+	if !ok {
+		return "", paramError(StageOptions, "method", CodeUnsupportedParam, "normalizeShadowsocks2022Password: unknown method %s", method)
+	}
+
+	if password == "" {
+		return "", paramError(StageOptions, "password", CodeMissingParam, "normalizeShadowsocks2022Password: %s: missing PSK", method)
+	}
+
+	keys := strings.Split(password, ":")
+	if len(keys) > 1 && method == "2022-blake3-chacha20-poly1305" {
+		return "", paramError(StageOptions, "password", CodeUnsupportedParam, "normalizeShadowsocks2022Password: %s: multi-user (EIH) PSKs are not supported", method)
+	}
+
+	for i, key := range keys {
+		// '+' may have been turned into a space by query unescaping
+		key = strings.ReplaceAll(strings.TrimSpace(key), " ", "+")
+
+		decoded, err := decodeBase64Lenient(key)
+		if err != nil {
+			return "", paramError(StageOptions, "password", CodeInvalidParam, "normalizeShadowsocks2022Password: %s: PSK #%d is not valid base64", method, i+1)
+		}
+
+		if len(decoded) != keyLength {
+			return "", paramError(StageOptions, "password", CodeInvalidParam, "normalizeShadowsocks2022Password: %s: PSK #%d must be %d bytes, got %d", method, i+1, keyLength, len(decoded))
+		}
+
+		keys[i] = base64.StdEncoding.EncodeToString(decoded)
+	}
+
+	return strings.Join(keys, ":"), nil
+}
+
+func formatShadowsocksProfile(o *option.ShadowsocksOutboundOptions, detours []option.Outbound, remark string) (string, error) {
+	u := &url.URL{
+		Scheme:   "ss",
+		Host:     formatServerHost(o.ServerOptions),
+		Fragment: remark,
+	}
+
+	// SIP002: 2022 keys are already base64, so they go percent-encoded instead of wrapped again
+	if strings.HasPrefix(o.Method, "2022-") {
+		u.User = url.UserPassword(o.Method, o.Password)
+	} else {
+		u.User = url.User(base64.RawURLEncoding.EncodeToString([]byte(o.Method + ":" + o.Password)))
+	}
+
+	plugin, err := formatSIP003Plugin(o, detours)
+	if err != nil {
+		return "", fmt.Errorf("formatShadowsocksProfile: %w", err)
+	}
+
+	query := url.Values{}
+	if plugin != "" {
+		query.Set("plugin", plugin)
+	}
+	formatOutboundMultiplexQuery(o.Multiplex, query)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// escapeShadowsocksUserInfo escapes the userinfo of links without a query, which TryFixURI
+// leaves as is. Plain SIP002 userinfo carries base64 2022 keys, whose '/' (and '+', already
+// unescaped into a space) break url.Parse.
+func escapeShadowsocksUserInfo(connURI string) string {
+	scheme, rest, ok := strings.Cut(connURI, "://")
+	if !ok || strings.Contains(rest, "?") {
+		return connURI
+	}
+	beforeRemark, remark, _ := strings.Cut(rest, "#")
+	userSplitIndex := strings.LastIndex(beforeRemark, "@")
+	if userSplitIndex == -1 {
+		return connURI
+	}
+	return scheme + "://" + url.QueryEscape(beforeRemark[:userSplitIndex]) + "@" + beforeRemark[userSplitIndex+1:] + "#" + remark
+}
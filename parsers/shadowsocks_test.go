@@ -0,0 +1,42 @@
+package parsers
+
+import (
+	"testing"
+
+	"github.com/sagernet/sing-box/option"
+)
+
+func TestShadowsocksParser2022PlainUserInfo(t *testing.T) {
+	const key = "+/+/+/+/+/+/+/+/+/+//g=="
+	const userKey = "AAECAwQFBgcICQoLDA0ODw=="
+
+	tests := []struct {
+		uri      string
+		password string
+	}{
+		{"ss://2022-blake3-aes-128-gcm:" + key + "@example.com:8388#plain", key},
+		{"ss://2022-blake3-aes-128-gcm:" + key + "@example.com:8388/?type=tcp#query", key},
+		{"ss://2022-blake3-aes-128-gcm:" + key + ":" + userKey + "@example.com:8388#eih", key + ":" + userKey},
+	}
+
+	for _, tt := range tests {
+		p, err := ParseProfile(tt.uri)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.uri, err)
+		}
+		o := p.Outbound.Options.(*option.ShadowsocksOutboundOptions)
+		if o.Method != "2022-blake3-aes-128-gcm" || o.Password != tt.password || o.ServerPort != 8388 {
+			t.Errorf("%s: got %s %s port %d", tt.uri, o.Method, o.Password, o.ServerPort)
+		}
+	}
+}
+
+func TestShadowsocksParser2022InvalidKey(t *testing.T) {
+	_, err := ParseProfile("ss://2022-blake3-aes-256-gcm:AAECAwQFBgcICQoLDA0ODw==@example.com:8388")
+	if err == nil {
+		t.Fatal("expected an error for a 16 byte key with a 32 byte method")
+	}
+	if code := err.(*ParseError).Code; code != CodeInvalidParam {
+		t.Errorf("got code %s, want %s", code, CodeInvalidParam)
+	}
+}
@@ -0,0 +1,167 @@
+package parsers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/include"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/json"
+)
+
+// Outbound types that route or drop traffic instead of proxying it
+var skippedSingBoxOutboundTypes = map[string]bool{
+	C.TypeSelector: true,
+	C.TypeURLTest:  true,
+	C.TypeDirect:   true,
+	C.TypeBlock:    true,
+	C.TypeDNS:      true,
+}
+
+// SingBoxParser parses a single profile serialized as a minimal sing-box config,
+// which is what ParseSingBoxConfig stores in ConnURI
+type SingBoxParser struct{}
+
+func (p SingBoxParser) ParseProfile(connURI string) (*ProxyProfile, error) {
+	profiles, errs := ParseSingBoxConfig([]byte(connURI))
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("SingBoxParser.ParseProfile: %w", errs[0])
+	}
+	if len(profiles) != 1 {
+		return nil, fmt.Errorf("SingBoxParser.ParseProfile: expected exactly one profile, got %d", len(profiles))
+	}
+	return &profiles[0], nil
+}
+
+// IsSingBoxConfig reports whether content looks like a sing-box JSON config
+func IsSingBoxConfig(content string) bool {
+	content = strings.TrimSpace(content)
+	return strings.HasPrefix(content, "{") &&
+		(strings.Contains(content, `"outbounds"`) || strings.Contains(content, `"endpoints"`))
+}
+
+// ParseSingBoxConfig turns every proxy outbound and WireGuard endpoint of a sing-box
+// config into a profile. Outbounds only used as another outbound's detour are attached
+// to that profile instead of becoming profiles of their own.
+func ParseSingBoxConfig(content []byte) ([]ProxyProfile, []error) {
+	ctx := include.Context(context.Background())
+
+	options, err := json.UnmarshalExtendedContext[option.Options](ctx, content)
+	if err != nil {
+		return nil, []error{paramError(StageDecode, "", CodeMalformedURI, "ParseSingBoxConfig: %w", err)}
+	}
+
+	outboundByTag := make(map[string]option.Outbound)
+	usedAsDetour := make(map[string]bool)
+	for _, o := range options.Outbounds {
+		if o.Tag != "" {
+			outboundByTag[o.Tag] = o
+		}
+		if detour := outboundDetour(&o); detour != "" {
+			usedAsDetour[detour] = true
+		}
+	}
+
+	var profiles []ProxyProfile
+	var errs []error
+
+	for i, o := range options.Outbounds {
+		if skippedSingBoxOutboundTypes[o.Type] || (o.Tag != "" && usedAsDetour[o.Tag]) {
+			continue
+		}
+
+		outbound := o
+		detours, err := resolveSingBoxDetours(&outbound, outboundByTag)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ParseSingBoxConfig: outbound #%d (%s): %w", i, o.Tag, err))
+			continue
+		}
+
+		profile := ProxyProfile{
+			Outbound: &outbound,
+			Detours:  detours,
+			Name:     o.Tag,
+		}
+
+		profile.ConnURI, err = marshalSingBoxProfile(ctx, &profile)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ParseSingBoxConfig: outbound #%d (%s): %w", i, o.Tag, err))
+			continue
+		}
+
+		profiles = append(profiles, profile)
+	}
+
+	for i, e := range options.Endpoints {
+		if e.Type != C.TypeWireGuard {
+			continue
+		}
+
+		endpoint := e
+		profile := ProxyProfile{
+			Endpoint: &endpoint,
+			Name:     e.Tag,
+		}
+
+		profile.ConnURI, err = marshalSingBoxProfile(ctx, &profile)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ParseSingBoxConfig: endpoint #%d (%s): %w", i, e.Tag, err))
+			continue
+		}
+
+		profiles = append(profiles, profile)
+	}
+
+	return profiles, errs
+}
+
+func outboundDetour(o *option.Outbound) string {
+	if wrapper, ok := o.Options.(option.DialerOptionsWrapper); ok {
+		return wrapper.TakeDialerOptions().Detour
+	}
+	return ""
+}
+
+func resolveSingBoxDetours(o *option.Outbound, outboundByTag map[string]option.Outbound) ([]option.Outbound, error) {
+	var detours []option.Outbound
+	seen := map[string]bool{o.Tag: true}
+
+	for detour := outboundDetour(o); detour != ""; {
+		if seen[detour] {
+			return nil, fmt.Errorf("resolveSingBoxDetours: detour loop at %s", detour)
+		}
+		seen[detour] = true
+
+		d, ok := outboundByTag[detour]
+		if !ok {
+			return nil, fmt.Errorf("resolveSingBoxDetours: detour %s not found", detour)
+		}
+		if skippedSingBoxOutboundTypes[d.Type] {
+			return nil, fmt.Errorf("resolveSingBoxDetours: unsupported detour type %s", d.Type)
+		}
+
+		detours = append(detours, d)
+		detour = outboundDetour(&d)
+	}
+
+	return detours, nil
+}
+
+// marshalSingBoxProfile serializes a profile as a single-line minimal sing-box config
+func marshalSingBoxProfile(ctx context.Context, p *ProxyProfile) (string, error) {
+	var options option.Options
+	if p.Endpoint != nil {
+		options.Endpoints = []option.Endpoint{*p.Endpoint}
+	} else {
+		options.Outbounds = append([]option.Outbound{*p.Outbound}, p.Detours...)
+	}
+
+	data, err := json.MarshalContext(ctx, options)
+	if err != nil {
+		return "", fmt.Errorf("marshalSingBoxProfile: %w", err)
+	}
+
+	return string(data), nil
+}
@@ -0,0 +1,158 @@
+package parsers
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing-box/transport/sip003"
+)
+
+const shadowTLSDetourTag = "shadowtls"
+
+// extractRawQueryParam reads a query parameter without url.ParseQuery,
+// which drops whole pairs containing ';' (and SIP003 plugin strings always do)
+func extractRawQueryParam(rawQuery string, key string) (string, error) {
+	for _, pair := range strings.Split(rawQuery, "&") {
+		k, v, _ := strings.Cut(pair, "=")
+		if k != key {
+			continue
+		}
+		unescaped, err := url.PathUnescape(v)
+		if err != nil {
+			return "", paramError(StageURI, key, CodeMalformedURI, "extractRawQueryParam: %w", err)
+		}
+		return unescaped, nil
+	}
+	return "", nil
+}
+
+// splitSIP003Plugin splits "name;k=v;flag" into the plugin name and its options string
+func splitSIP003Plugin(plugin string) (string, string) {
+	for i := 0; i < len(plugin); i++ {
+		if plugin[i] == '\\' {
+			i++
+			continue
+		}
+		if plugin[i] == ';' {
+			return plugin[:i], plugin[i+1:]
+		}
+	}
+	return plugin, ""
+}
+
+// applySIP003Plugin maps a SIP003 plugin string onto the shadowsocks outbound.
+// Returned outbounds are detours the shadowsocks outbound dials through.
+func applySIP003Plugin(plugin string, ssOptions *option.ShadowsocksOutboundOptions) ([]option.Outbound, error) {
+	name, pluginOpts := splitSIP003Plugin(strings.TrimSpace(plugin))
+
+	args, err := sip003.ParsePluginOptions(pluginOpts)
+	if err != nil {
+		return nil, paramError(StagePlugin, "plugin", CodeInvalidParam, "applySIP003Plugin: malformed plugin options: %w", err)
+	}
+
+	switch name {
+	case "":
+		return nil, nil
+	case "obfs-local", "simple-obfs":
+		if mode, ok := args.Get("obfs"); ok && mode != "http" && mode != "tls" {
+			return nil, paramError(StagePlugin, "obfs", CodeUnsupportedParam, "applySIP003Plugin: unsupported obfs mode %s", mode)
+		}
+		ssOptions.Plugin = "obfs-local"
+		ssOptions.PluginOptions = pluginOpts
+		return nil, nil
+	case "v2ray-plugin":
+		if mode, ok := args.Get("mode"); ok && mode != "websocket" && mode != "quic" {
+			return nil, paramError(StagePlugin, "mode", CodeUnsupportedParam, "applySIP003Plugin: unsupported v2ray-plugin mode %s", mode)
+		}
+		ssOptions.Plugin = "v2ray-plugin"
+		ssOptions.PluginOptions = pluginOpts
+		return nil, nil
+	case "shadow-tls":
+		shadowTLS, err := buildShadowTLSDetour(args, ssOptions.ServerOptions)
+		if err != nil {
+			return nil, fmt.Errorf("applySIP003Plugin: %w", err)
+		}
+		ssOptions.Detour = shadowTLS.Tag
+		return []option.Outbound{*shadowTLS}, nil
+	default:
+		return nil, paramError(StagePlugin, "plugin", CodeUnsupportedParam, "applySIP003Plugin: unsupported plugin %s", name)
+	}
+}
+
+func buildShadowTLSDetour(args sip003.Args, server option.ServerOptions) (*option.Outbound, error) {
+	host, _ := args.Get("host")
+	password, _ := args.Get("password")
+
+	if host == "" {
+		return nil, paramError(StagePlugin, "host", CodeMissingParam, "buildShadowTLSDetour: missing host")
+	}
+
+	version := 2
+	if versionStr, ok := args.Get("version"); ok {
+		v, err := strconv.Atoi(versionStr)
+		if err != nil || v < 1 || v > 3 {
+			return nil, paramError(StagePlugin, "version", CodeInvalidParam, "buildShadowTLSDetour: invalid version %s", versionStr)
+		}
+		version = v
+	} else if _, ok := args.Get("v3"); ok {
+		version = 3
+	}
+
+	if version > 1 && password == "" {
+		return nil, paramError(StagePlugin, "password", CodeMissingParam, "buildShadowTLSDetour: missing password")
+	}
+
+	return &option.Outbound{
+		Type: "shadowtls",
+		Tag:  shadowTLSDetourTag,
+		Options: &option.ShadowTLSOutboundOptions{
+			ServerOptions: server,
+			Version:       version,
+			Password:      password,
+			OutboundTLSOptionsContainer: option.OutboundTLSOptionsContainer{
+				TLS: &option.OutboundTLSOptions{
+					Enabled:    true,
+					ServerName: host,
+				},
+			},
+		},
+	}, nil
+}
+
+// formatSIP003Plugin is the inverse of applySIP003Plugin
+func formatSIP003Plugin(o *option.ShadowsocksOutboundOptions, detours []option.Outbound) (string, error) {
+	if o.Plugin != "" {
+		if o.PluginOptions == "" {
+			return o.Plugin, nil
+		}
+		return o.Plugin + ";" + o.PluginOptions, nil
+	}
+
+	if o.Detour == "" {
+		return "", nil
+	}
+
+	for _, d := range detours {
+		if d.Tag != o.Detour {
+			continue
+		}
+		shadowTLS, ok := d.Options.(*option.ShadowTLSOutboundOptions)
+		if !ok {
+			return "", fmt.Errorf("formatSIP003Plugin: detour type %s cannot be expressed as a plugin", d.Type)
+		}
+		if shadowTLS.TLS == nil || shadowTLS.TLS.ServerName == "" {
+			return "", errors.New("formatSIP003Plugin: shadowtls detour without server name")
+		}
+		plugin := "shadow-tls;host=" + sip003Escape(shadowTLS.TLS.ServerName)
+		if shadowTLS.Password != "" {
+			plugin += ";password=" + sip003Escape(shadowTLS.Password)
+		}
+		return plugin + ";version=" + strconv.Itoa(shadowTLS.Version), nil
+	}
+
+	return "", fmt.Errorf("formatSIP003Plugin: detour %s not found", o.Detour)
+}
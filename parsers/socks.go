@@ -0,0 +1,91 @@
+package parsers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/bluegradienthorizon/singtoolbox/utils"
+
+	"github.com/sagernet/sing-box/option"
+)
+
+type SOCKSParser struct{}
+
+func (p SOCKSParser) ParseProfile(connURI string) (*ProxyProfile, error) {
+	connURI, uriFixes, err := utils.TryFixURI(connURI)
+	if err != nil {
+		return nil, paramError(StageURI, "", CodeMalformedURI, "SOCKSParser.ParseProfile: %w", err)
+	}
+
+	scheme, _, _ := strings.Cut(connURI, "://")
+
+	var version string
+	switch scheme {
+	case "socks", "socks5", "socks5h":
+		version = "5"
+	case "socks4":
+		version = "4"
+	case "socks4a":
+		version = "4a"
+	default:
+		return nil, paramError(StageURI, "", CodeUnknownScheme, "SOCKSParser.ParseProfile: unsupported scheme %s", scheme)
+	}
+
+	uri, addr, port, err := extractCommonURIData(connURI, scheme)
+	if err != nil {
+		return nil, fmt.Errorf("SOCKSParser.ParseProfile: %w", err)
+	}
+
+	if port == 0 {
+		port = 1080
+	}
+
+	username, password := extractProxyCredentials(uri.User)
+
+	o := &option.Outbound{
+		Type: "socks",
+		Options: &option.SOCKSOutboundOptions{
+			ServerOptions: option.ServerOptions{
+				Server:     addr,
+				ServerPort: port,
+			},
+			Version:  version,
+			Username: username,
+			Password: password,
+		},
+	}
+
+	return &ProxyProfile{
+		Outbound: o,
+		ConnURI:  connURI,
+		URIFixes: uriFixes,
+	}, nil
+}
+
+// extractProxyCredentials also handles v2rayN style links, where "user:pass"
+// is base64 encoded into the username part
+func extractProxyCredentials(user *url.Userinfo) (string, string) {
+	username := user.Username()
+	if password, ok := user.Password(); ok {
+		return username, password
+	}
+
+	if decoded, err := base64.StdEncoding.DecodeString(username); err == nil {
+		if u, p, found := strings.Cut(string(decoded), ":"); found {
+			return u, p
+		}
+	}
+	if decoded, err := base64.RawURLEncoding.DecodeString(username); err == nil {
+		if u, p, found := strings.Cut(string(decoded), ":"); found {
+			return u, p
+		}
+	}
+
+	if u, p, found := strings.Cut(username, ":"); found {
+		return u, p
+	}
+
+	return username, ""
+}
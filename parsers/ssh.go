@@ -0,0 +1,162 @@
+package parsers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bluegradienthorizon/singtoolbox/utils"
+
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/json/badoption"
+)
+
+type SSHParser struct{}
+
+func (p SSHParser) ParseProfile(connURI string) (*ProxyProfile, error) {
+	connURI, uriFixes, err := utils.TryFixURI(connURI)
+	if err != nil {
+		return nil, paramError(StageURI, "", CodeMalformedURI, "SSHParser.ParseProfile: %w", err)
+	}
+
+	uri, addr, port, err := extractCommonURIData(connURI, "ssh")
+	if err != nil {
+		return nil, fmt.Errorf("SSHParser.ParseProfile: %w", err)
+	}
+
+	if port == 0 {
+		port = 22
+	}
+
+	params := uri.Query()
+
+	user := uri.User.Username()
+	password, hasPassword := uri.User.Password()
+	if !hasPassword {
+		user, password, _ = strings.Cut(user, ":")
+	}
+
+	privateKey := firstParam(params, "private_key", "privateKey", "pk")
+	privateKeyPath := firstParam(params, "private_key_path", "privateKeyPath")
+	passphrase := firstParam(params, "private_key_passphrase", "passphrase")
+	hostKey := firstParam(params, "host_key", "hostKey")
+	hostKeyAlgorithms := firstParam(params, "host_key_algorithms", "hostKeyAlgorithms")
+	clientVersion := firstParam(params, "client_version", "clientVersion")
+
+	var inlineKey badoption.Listable[string]
+	if privateKey != "" {
+		key, isInline := normalizeSSHPrivateKey(privateKey)
+		if isInline {
+			inlineKey = badoption.Listable[string]{key}
+		} else if privateKeyPath == "" {
+			privateKeyPath = key
+		}
+	}
+
+	if privateKeyPath != "" {
+		if _, err := os.Stat(privateKeyPath); err != nil {
+			return nil, paramError(StageOptions, "private_key_path", CodeInvalidParam, "SSHParser.ParseProfile: private key file: %w", err)
+		}
+	}
+
+	if password == "" && len(inlineKey) == 0 && privateKeyPath == "" {
+		return nil, paramError(StageOptions, "password", CodeMissingParam, "SSHParser.ParseProfile: neither password nor private key provided")
+	}
+
+	var hostKeys badoption.Listable[string]
+	if hostKey != "" {
+		for _, val := range strings.Split(hostKey, ",") {
+			if val = normalizeSSHHostKey(val); val != "" {
+				hostKeys = append(hostKeys, val)
+			}
+		}
+	}
+
+	var algorithms badoption.Listable[string]
+	if hostKeyAlgorithms != "" {
+		for _, val := range strings.Split(hostKeyAlgorithms, ",") {
+			algorithms = append(algorithms, strings.TrimSpace(val))
+		}
+	}
+
+	o := &option.Outbound{
+		Type: "ssh",
+		Options: &option.SSHOutboundOptions{
+			ServerOptions: option.ServerOptions{
+				Server:     addr,
+				ServerPort: port,
+			},
+			User:                 user,
+			Password:             password,
+			PrivateKey:           inlineKey,
+			PrivateKeyPath:       privateKeyPath,
+			PrivateKeyPassphrase: passphrase,
+			HostKey:              hostKeys,
+			HostKeyAlgorithms:    algorithms,
+			ClientVersion:        clientVersion,
+		},
+	}
+
+	return &ProxyProfile{
+		Outbound: o,
+		ConnURI:  connURI,
+		URIFixes: uriFixes,
+	}, nil
+}
+
+// normalizeSSHPrivateKey returns an inline PEM key and true, or a file path and false.
+// TryFixURI strips encoded newlines and query unescaping turns '+' into spaces,
+// so inline PEM bodies have to be rebuilt before sing-box can read them.
+func normalizeSSHPrivateKey(key string) (string, bool) {
+	key = strings.TrimSpace(key)
+
+	if !strings.Contains(key, "-----BEGIN") {
+		decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(key, " ", "+"))
+		if err != nil {
+			decoded, err = base64.RawURLEncoding.DecodeString(key)
+		}
+		if err != nil || !strings.Contains(string(decoded), "-----BEGIN") {
+			return key, false
+		}
+		return string(decoded), true
+	}
+
+	headerStart := strings.Index(key, "-----BEGIN")
+	headerEnd := strings.Index(key[headerStart+len("-----BEGIN"):], "-----")
+	footerStart := strings.LastIndex(key, "-----END")
+	if headerEnd == -1 || footerStart == -1 {
+		return key, true
+	}
+	headerEnd += headerStart + len("-----BEGIN") + len("-----")
+	if headerEnd > footerStart {
+		return key, true
+	}
+
+	header := key[headerStart:headerEnd]
+	footer := key[footerStart:]
+	body := strings.ReplaceAll(strings.TrimSpace(key[headerEnd:footerStart]), " ", "+")
+
+	var builder strings.Builder
+	builder.WriteString(header + "\n")
+	for len(body) > 64 {
+		builder.WriteString(body[:64] + "\n")
+		body = body[64:]
+	}
+	if body != "" {
+		builder.WriteString(body + "\n")
+	}
+	builder.WriteString(footer)
+
+	return builder.String(), true
+}
+
+// normalizeSSHHostKey restores "<algorithm> <base64>" where '+' was turned into spaces
+func normalizeSSHHostKey(hostKey string) string {
+	hostKey = strings.TrimSpace(hostKey)
+	algorithm, key, found := strings.Cut(hostKey, " ")
+	if !found {
+		return hostKey
+	}
+	return algorithm + " " + strings.ReplaceAll(strings.TrimSpace(key), " ", "+")
+}
@@ -1,7 +1,8 @@
 package parsers
 
 import (
-	"errors"
+	"fmt"
+	"net/url"
 
 	"github.com/bluegradienthorizon/singtoolbox/utils"
 
@@ -11,14 +12,14 @@ import (
 type TrojanParser struct{}
 
 func (p TrojanParser) ParseProfile(connURI string) (*ProxyProfile, error) {
-	connURI, err := utils.TryFixURI(connURI)
+	connURI, uriFixes, err := utils.TryFixURI(connURI)
 	if err != nil {
-		return nil, errors.New("TrojanParser.ParseProfile: " + err.Error())
+		return nil, paramError(StageURI, "", CodeMalformedURI, "TrojanParser.ParseProfile: %w", err)
 	}
 
 	url, addr, port, err := extractCommonURIData(connURI, "trojan")
 	if err != nil {
-		return nil, errors.New("TrojanParser.ParseProfile: " + err.Error())
+		return nil, fmt.Errorf("TrojanParser.ParseProfile: %w", err)
 	}
 
 	params := url.Query()
@@ -27,12 +28,22 @@ func (p TrojanParser) ParseProfile(connURI string) (*ProxyProfile, error) {
 
 	TLSOptions, err := buildOutboundTLSOptions(params, "trojan")
 	if err != nil {
-		return nil, errors.New("TrojanParser.ParseProfile: " + err.Error())
+		return nil, fmt.Errorf("TrojanParser.ParseProfile: %w", err)
 	}
+	warnings := tlsWarnings(params, TLSOptions)
 
 	transportOptions, err := buildV2RayTransportOptions(params, "trojan")
 	if err != nil {
-		return nil, errors.New("TrojanParser.ParseProfile: " + err.Error())
+		return nil, fmt.Errorf("TrojanParser.ParseProfile: %w", err)
+	}
+
+	if err := applyGRPCAuthority(params, addr, TLSOptions, transportOptions); err != nil {
+		return nil, fmt.Errorf("TrojanParser.ParseProfile: %w", err)
+	}
+
+	multiplexOptions, err := buildOutboundMultiplexOptions(params)
+	if err != nil {
+		return nil, fmt.Errorf("TrojanParser.ParseProfile: %w", err)
 	}
 
 	o := &option.Outbound{
@@ -47,11 +58,35 @@ func (p TrojanParser) ParseProfile(connURI string) (*ProxyProfile, error) {
 				TLS: TLSOptions,
 			},
 			Transport: transportOptions,
+			Multiplex: multiplexOptions,
 		},
 	}
 
 	return &ProxyProfile{
 		Outbound: o,
 		ConnURI:  connURI,
+		Warnings: warnings,
+		URIFixes: uriFixes,
 	}, nil
 }
+
+func formatTrojanProfile(o *option.TrojanOutboundOptions, remark string) (string, error) {
+	query := url.Values{}
+
+	formatOutboundTLSQuery(o.TLS, query, "trojan")
+	formatOutboundMultiplexQuery(o.Multiplex, query)
+
+	if err := formatV2RayTransportQuery(o.Transport, query, "trojan"); err != nil {
+		return "", fmt.Errorf("formatTrojanProfile: %w", err)
+	}
+
+	u := &url.URL{
+		Scheme:   "trojan",
+		User:     url.User(o.Password),
+		Host:     formatServerHost(o.ServerOptions),
+		RawQuery: query.Encode(),
+		Fragment: remark,
+	}
+
+	return u.String(), nil
+}
@@ -0,0 +1,30 @@
+package parsers
+
+import (
+	"testing"
+
+	"github.com/sagernet/sing-box/option"
+)
+
+func TestTrojanParserPassword(t *testing.T) {
+	tests := []struct {
+		uri      string
+		password string
+	}{
+		{"trojan://secret@example.com:443?security=tls#plain", "secret"},
+		{"trojan://p%40ss%2Fw0rd@example.com:443?security=tls#escaped", "p@ss/w0rd"},
+		{"trojan://p%40ss%2Fw0rd@example.com:443#escaped-no-query", "p@ss/w0rd"},
+		{"trojan://a+b:c@example.com:443?security=tls#plus-colon", "a+b:c"},
+	}
+
+	for _, tt := range tests {
+		p, err := ParseProfile(tt.uri)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.uri, err)
+		}
+		o := p.Outbound.Options.(*option.TrojanOutboundOptions)
+		if o.Password != tt.password {
+			t.Errorf("%s: got password %q, want %q", tt.uri, o.Password, tt.password)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package parsers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bluegradienthorizon/singtoolbox/utils"
+
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/json/badoption"
+)
+
+type TUICParser struct{}
+
+func (p TUICParser) ParseProfile(connURI string) (*ProxyProfile, error) {
+	connURI, uriFixes, err := utils.TryFixURI(connURI)
+	if err != nil {
+		return nil, paramError(StageURI, "", CodeMalformedURI, "TUICParser.ParseProfile: %w", err)
+	}
+
+	uri, addr, port, err := extractCommonURIData(connURI, "tuic")
+	if err != nil {
+		return nil, fmt.Errorf("TUICParser.ParseProfile: %w", err)
+	}
+
+	params := uri.Query()
+
+	// userinfo may arrive either as "uuid:password" or escaped as a single username
+	uuid := uri.User.Username()
+	password, hasPassword := uri.User.Password()
+	if !hasPassword {
+		uuid, password, _ = strings.Cut(uuid, ":")
+	}
+
+	if uuid == "" {
+		return nil, paramError(StageOptions, "uuid", CodeMissingParam, "TUICParser.ParseProfile: missing uuid")
+	}
+
+	sni := params.Get("sni")
+	alpn := params.Get("alpn")
+	congestionControl := params.Get("congestion_control")
+	udpRelayMode := params.Get("udp_relay_mode")
+	allowInsecure := params.Get("allow_insecure") == "1" || params.Get("insecure") == "1"
+	disableSNI := params.Get("disable_sni") == "1"
+
+	if udpRelayMode != "" && udpRelayMode != "native" && udpRelayMode != "quic" {
+		return nil, paramError(StageOptions, "udp_relay_mode", CodeUnsupportedParam, "TUICParser.ParseProfile: unsupported udp_relay_mode %s", udpRelayMode)
+	}
+
+	TLSOptions := &option.OutboundTLSOptions{
+		Enabled:    true,
+		ServerName: sni,
+		Insecure:   allowInsecure,
+		DisableSNI: disableSNI,
+	}
+
+	if alpn != "" {
+		TLSOptions.ALPN = badoption.Listable[string]{}
+		for _, val := range strings.Split(alpn, ",") {
+			TLSOptions.ALPN = append(TLSOptions.ALPN, val)
+		}
+	}
+
+	o := &option.Outbound{
+		Type: "tuic",
+		Options: &option.TUICOutboundOptions{
+			ServerOptions: option.ServerOptions{
+				Server:     addr,
+				ServerPort: port,
+			},
+			UUID:              uuid,
+			Password:          password,
+			CongestionControl: congestionControl,
+			UDPRelayMode:      udpRelayMode,
+			OutboundTLSOptionsContainer: option.OutboundTLSOptionsContainer{
+				TLS: TLSOptions,
+			},
+		},
+	}
+
+	return &ProxyProfile{
+		Outbound: o,
+		ConnURI:  connURI,
+		URIFixes: uriFixes,
+	}, nil
+}
@@ -1,7 +1,8 @@
 package parsers
 
 import (
-	"errors"
+	"fmt"
+	"net/url"
 
 	"github.com/bluegradienthorizon/singtoolbox/utils"
 
@@ -11,31 +12,53 @@ import (
 type VLESSParser struct{}
 
 func (p VLESSParser) ParseProfile(connURI string) (*ProxyProfile, error) {
-	connURI, err := utils.TryFixURI(connURI)
+	connURI, uriFixes, err := utils.TryFixURI(connURI)
 	if err != nil {
-		return nil, errors.New("VLESSParser.ParseProfile: " + err.Error())
+		return nil, paramError(StageURI, "", CodeMalformedURI, "VLESSParser.ParseProfile: %w", err)
 	}
 
 	uri, addr, port, err := extractCommonURIData(connURI, "vless")
 	if err != nil {
-		return nil, errors.New("VLESSParser.ParseProfile: " + err.Error())
+		return nil, fmt.Errorf("VLESSParser.ParseProfile: %w", err)
 	}
 
 	params := uri.Query()
 
+	var warnings parseWarnings
+
 	flow := params.Get("flow")
 	if flow == "xtls-rprx-vision-udp443" {
 		flow = "xtls-rprx-vision"
+		warnings.add("flow", WarnCoercedValue, "xtls-rprx-vision-udp443 replaced with xtls-rprx-vision")
+	}
+
+	if encryption := params.Get("encryption"); encryption != "" && encryption != "none" {
+		warnings.add("encryption", WarnIgnoredParam, "VLESS encryption %s is not supported by sing-box", encryption)
 	}
 
 	TLSOptions, err := buildOutboundTLSOptions(params, "vless")
 	if err != nil {
-		return nil, errors.New("VLESSParser.ParseProfile: " + err.Error())
+		return nil, fmt.Errorf("VLESSParser.ParseProfile: %w", err)
 	}
+	warnings = append(warnings, tlsWarnings(params, TLSOptions)...)
 
 	transportOptions, err := buildV2RayTransportOptions(params, "vless")
 	if err != nil {
-		return nil, errors.New("VLESSParser.ParseProfile: " + err.Error())
+		return nil, fmt.Errorf("VLESSParser.ParseProfile: %w", err)
+	}
+
+	if err := applyGRPCAuthority(params, addr, TLSOptions, transportOptions); err != nil {
+		return nil, fmt.Errorf("VLESSParser.ParseProfile: %w", err)
+	}
+
+	multiplexOptions, err := buildOutboundMultiplexOptions(params)
+	if err != nil {
+		return nil, fmt.Errorf("VLESSParser.ParseProfile: %w", err)
+	}
+
+	packetEncoding, err := parsePacketEncoding(params)
+	if err != nil {
+		return nil, fmt.Errorf("VLESSParser.ParseProfile: %w", err)
 	}
 
 	o := &option.Outbound{
@@ -49,13 +72,52 @@ func (p VLESSParser) ParseProfile(connURI string) (*ProxyProfile, error) {
 			OutboundTLSOptionsContainer: option.OutboundTLSOptionsContainer{
 				TLS: TLSOptions,
 			},
-			Transport: transportOptions,
-			Flow:      flow,
+			Transport:      transportOptions,
+			Flow:           flow,
+			Multiplex:      multiplexOptions,
+			PacketEncoding: packetEncoding,
 		},
 	}
 
 	return &ProxyProfile{
 		Outbound: o,
 		ConnURI:  connURI,
+		Warnings: warnings,
+		URIFixes: uriFixes,
 	}, nil
 }
+
+func formatVLESSProfile(o *option.VLESSOutboundOptions, remark string) (string, error) {
+	query := url.Values{}
+	query.Set("encryption", "none")
+
+	if o.Flow != "" {
+		query.Set("flow", o.Flow)
+	}
+
+	if o.PacketEncoding != nil {
+		if *o.PacketEncoding == "" {
+			query.Set("packetEncoding", "none")
+		} else {
+			query.Set("packetEncoding", *o.PacketEncoding)
+		}
+	}
+
+	formatOutboundMultiplexQuery(o.Multiplex, query)
+
+	formatOutboundTLSQuery(o.TLS, query, "vless")
+
+	if err := formatV2RayTransportQuery(o.Transport, query, "vless"); err != nil {
+		return "", fmt.Errorf("formatVLESSProfile: %w", err)
+	}
+
+	u := &url.URL{
+		Scheme:   "vless",
+		User:     url.User(o.UUID),
+		Host:     formatServerHost(o.ServerOptions),
+		RawQuery: query.Encode(),
+		Fragment: remark,
+	}
+
+	return u.String(), nil
+}
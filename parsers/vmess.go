@@ -3,19 +3,21 @@ package parsers
 import (
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/url"
 	"strconv"
 	"strings"
 
 	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
 )
 
 type VMessParser struct{}
 
 func (p VMessParser) ParseProfile(connURI string) (*ProxyProfile, error) {
 	base64Part := strings.ReplaceAll(connURI, "vmess://", "")
+	// Some links carry the remark as a fragment after the base64 JSON
+	base64Part, _, _ = strings.Cut(base64Part, "#")
 
 	var enc *base64.Encoding
 	isURL := strings.ContainsAny(base64Part, "-_")
@@ -34,20 +36,28 @@ func (p VMessParser) ParseProfile(connURI string) (*ProxyProfile, error) {
 
 	decodedBytes, err := enc.DecodeString(base64Part)
 	if err != nil {
-		return nil, errors.New("VMessParser.ParseProfile: " + err.Error())
+		return nil, paramError(StageDecode, "", CodeMalformedURI, "VMessParser.ParseProfile: %w", err)
 	}
 
 	var tempMap map[string]any
 	if err := json.Unmarshal(decodedBytes, &tempMap); err != nil {
-		return nil, errors.New("VMessParser.ParseProfile: " + err.Error())
+		return nil, paramError(StageDecode, "", CodeMalformedURI, "VMessParser.ParseProfile: %w", err)
 	}
 
 	query := map[string]string{}
+	var headers []string
 	for k, v := range tempMap {
 		if v == nil {
 			query[k] = ""
 			continue
 		}
+		// Transport headers are a nested {"Name": "Value"} object
+		if m, ok := v.(map[string]any); ok && k == "headers" {
+			for name, value := range m {
+				headers = append(headers, name+": "+fmt.Sprintf("%v", value))
+			}
+			continue
+		}
 		query[k] = fmt.Sprintf("%v", v)
 	}
 
@@ -55,25 +65,51 @@ func (p VMessParser) ParseProfile(connURI string) (*ProxyProfile, error) {
 	for k, v := range query {
 		params[k] = []string{v}
 	}
+	if len(headers) > 0 {
+		params["header"] = headers
+	}
 
 	addr := params.Get("add")
 	portUnchecked, err := strconv.ParseUint(params.Get("port"), 10, 16)
 	if err != nil {
-		return nil, errors.New("VMessParser.ParseProfile: " + err.Error())
+		return nil, paramError(StageURI, "port", CodeInvalidAddress, "VMessParser.ParseProfile: %w", err)
 	}
 	port := uint16(portUnchecked)
-	// remark := params.Get("ps")
+	remark := strings.TrimSpace(params.Get("ps"))
 	id := params.Get("id")
 	security := params.Get("scy")
 
+	alterID := 0
+	if aid := strings.TrimSpace(params.Get("aid")); aid != "" {
+		alterID, err = strconv.Atoi(aid)
+		if err != nil || alterID < 0 {
+			return nil, paramError(StageOptions, "aid", CodeInvalidParam, "VMessParser.ParseProfile: invalid alterId %s", aid)
+		}
+	}
+
 	TLSOptions, err := buildOutboundTLSOptions(params, "vmess")
 	if err != nil {
-		return nil, errors.New("VMessParser.ParseProfile: " + err.Error())
+		return nil, fmt.Errorf("VMessParser.ParseProfile: %w", err)
 	}
+	warnings := tlsWarnings(params, TLSOptions)
 
 	transportOptions, err := buildV2RayTransportOptions(params, "vmess")
 	if err != nil {
-		return nil, errors.New("VMessParser.ParseProfile: " + err.Error())
+		return nil, fmt.Errorf("VMessParser.ParseProfile: %w", err)
+	}
+
+	if err := applyGRPCAuthority(params, addr, TLSOptions, transportOptions); err != nil {
+		return nil, fmt.Errorf("VMessParser.ParseProfile: %w", err)
+	}
+
+	multiplexOptions, err := buildOutboundMultiplexOptions(params)
+	if err != nil {
+		return nil, fmt.Errorf("VMessParser.ParseProfile: %w", err)
+	}
+
+	packetEncoding, err := parsePacketEncoding(params)
+	if err != nil {
+		return nil, fmt.Errorf("VMessParser.ParseProfile: %w", err)
 	}
 
 	o := &option.Outbound{
@@ -85,15 +121,77 @@ func (p VMessParser) ParseProfile(connURI string) (*ProxyProfile, error) {
 			},
 			UUID:     id,
 			Security: security,
+			AlterId:  alterID,
 			OutboundTLSOptionsContainer: option.OutboundTLSOptionsContainer{
 				TLS: TLSOptions,
 			},
-			Transport: transportOptions,
+			Transport:      transportOptions,
+			Multiplex:      multiplexOptions,
+			PacketEncoding: common.PtrValueOrDefault(packetEncoding),
 		},
 	}
 
 	return &ProxyProfile{
 		Outbound: o,
 		ConnURI:  connURI,
+		Name:     remark,
+		Warnings: warnings,
 	}, nil
 }
+
+func formatVMessProfile(o *option.VMessOutboundOptions, remark string) (string, error) {
+	query := url.Values{}
+
+	formatOutboundTLSQuery(o.TLS, query, "vmess")
+	formatOutboundMultiplexQuery(o.Multiplex, query)
+
+	if o.PacketEncoding != "" {
+		query.Set("packetEncoding", o.PacketEncoding)
+	}
+
+	if err := formatV2RayTransportQuery(o.Transport, query, "vmess"); err != nil {
+		return "", fmt.Errorf("formatVMessProfile: %w", err)
+	}
+
+	fields := map[string]any{
+		"v":    "2",
+		"ps":   remark,
+		"add":  o.Server,
+		"port": strconv.Itoa(int(o.ServerPort)),
+		"id":   o.UUID,
+		"aid":  strconv.Itoa(o.AlterId),
+		"scy":  o.Security,
+		"type": "none",
+	}
+	for k := range query {
+		fields[k] = query.Get(k)
+	}
+	if headers := vmessHeaders(query["header"]); headers != nil {
+		delete(fields, "header")
+		fields["headers"] = headers
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("formatVMessProfile: %w", err)
+	}
+
+	return "vmess://" + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// vmessHeaders turns repeated "header" query values into the vmess JSON "headers" object,
+// which only holds one value per name
+func vmessHeaders(values []string) map[string]string {
+	if len(values) == 0 {
+		return nil
+	}
+	headers := map[string]string{}
+	for _, v := range values {
+		name, value, _ := strings.Cut(v, ":")
+		name = strings.TrimSpace(name)
+		if _, ok := headers[name]; !ok {
+			headers[name] = strings.TrimSpace(value)
+		}
+	}
+	return headers
+}
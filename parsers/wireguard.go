@@ -0,0 +1,184 @@
+package parsers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bluegradienthorizon/singtoolbox/utils"
+
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/json/badoption"
+)
+
+type WireGuardParser struct{}
+
+func (p WireGuardParser) ParseProfile(connURI string) (*ProxyProfile, error) {
+	connURI, uriFixes, err := utils.TryFixURI(connURI)
+	if err != nil {
+		return nil, paramError(StageURI, "", CodeMalformedURI, "WireGuardParser.ParseProfile: %w", err)
+	}
+
+	uri, addr, port, err := extractCommonURIData(connURI, "wireguard")
+	if err != nil {
+		return nil, fmt.Errorf("WireGuardParser.ParseProfile: %w", err)
+	}
+
+	params := uri.Query()
+
+	privateKey := uri.User.Username()
+	if privateKey == "" {
+		privateKey = firstParam(params, "privatekey", "private_key", "pk")
+	}
+	publicKey := firstParam(params, "publickey", "public_key", "peer_public_key", "peer_pk")
+	preSharedKey := firstParam(params, "presharedkey", "pre_shared_key", "psk")
+
+	privateKey = fixWireGuardKey(privateKey)
+	publicKey = fixWireGuardKey(publicKey)
+	preSharedKey = fixWireGuardKey(preSharedKey)
+
+	if privateKey == "" {
+		return nil, paramError(StageOptions, "privatekey", CodeMissingParam, "WireGuardParser.ParseProfile: missing private key")
+	}
+	if publicKey == "" {
+		return nil, paramError(StageOptions, "publickey", CodeMissingParam, "WireGuardParser.ParseProfile: missing peer public key")
+	}
+
+	localAddress, err := parseWireGuardAddresses(firstParam(params, "address", "local_address", "ip"))
+	if err != nil {
+		return nil, fmt.Errorf("WireGuardParser.ParseProfile: %w", err)
+	}
+	if len(localAddress) == 0 {
+		return nil, paramError(StageOptions, "address", CodeMissingParam, "WireGuardParser.ParseProfile: missing local address")
+	}
+
+	reserved, err := parseWireGuardReserved(params.Get("reserved"))
+	if err != nil {
+		return nil, fmt.Errorf("WireGuardParser.ParseProfile: %w", err)
+	}
+
+	var mtu uint32
+	if mtuStr := params.Get("mtu"); mtuStr != "" {
+		mtuUnchecked, err := strconv.ParseUint(mtuStr, 10, 32)
+		if err != nil {
+			return nil, paramError(StageOptions, "mtu", CodeInvalidParam, "WireGuardParser.ParseProfile: invalid mtu: %w", err)
+		}
+		mtu = uint32(mtuUnchecked)
+	}
+
+	var keepalive uint16
+	if keepaliveStr := params.Get("keepalive"); keepaliveStr != "" {
+		keepaliveUnchecked, err := strconv.ParseUint(keepaliveStr, 10, 16)
+		if err != nil {
+			return nil, paramError(StageOptions, "keepalive", CodeInvalidParam, "WireGuardParser.ParseProfile: invalid keepalive: %w", err)
+		}
+		keepalive = uint16(keepaliveUnchecked)
+	}
+
+	e := &option.Endpoint{
+		Type: "wireguard",
+		Options: &option.WireGuardEndpointOptions{
+			MTU:        mtu,
+			Address:    localAddress,
+			PrivateKey: privateKey,
+			Peers: []option.WireGuardPeer{
+				{
+					Address:      addr,
+					Port:         port,
+					PublicKey:    publicKey,
+					PreSharedKey: preSharedKey,
+					AllowedIPs: badoption.Listable[netip.Prefix]{
+						netip.MustParsePrefix("0.0.0.0/0"),
+						netip.MustParsePrefix("::/0"),
+					},
+					PersistentKeepaliveInterval: keepalive,
+					Reserved:                    reserved,
+				},
+			},
+		},
+	}
+
+	return &ProxyProfile{
+		Endpoint: e,
+		ConnURI:  connURI,
+		URIFixes: uriFixes,
+	}, nil
+}
+
+func firstParam(params url.Values, keys ...string) string {
+	for _, key := range keys {
+		if val := params.Get(key); val != "" {
+			return val
+		}
+	}
+	return ""
+}
+
+// Keys are standard base64, so any space here is a '+' lost to query unescaping
+func fixWireGuardKey(key string) string {
+	return strings.ReplaceAll(strings.TrimSpace(key), " ", "+")
+}
+
+func parseWireGuardAddresses(addresses string) (badoption.Listable[netip.Prefix], error) {
+	var prefixes badoption.Listable[netip.Prefix]
+
+	for _, val := range strings.Split(addresses, ",") {
+		val = strings.TrimSpace(val)
+		if val == "" {
+			continue
+		}
+
+		if strings.Contains(val, "/") {
+			prefix, err := netip.ParsePrefix(val)
+			if err != nil {
+				return nil, paramError(StageOptions, "address", CodeInvalidParam, "parseWireGuardAddresses: invalid address %s", val)
+			}
+			prefixes = append(prefixes, prefix)
+			continue
+		}
+
+		ip, err := netip.ParseAddr(strings.Trim(val, "[]"))
+		if err != nil {
+			return nil, paramError(StageOptions, "address", CodeInvalidParam, "parseWireGuardAddresses: invalid address %s", val)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(ip, ip.BitLen()))
+	}
+
+	return prefixes, nil
+}
+
+func parseWireGuardReserved(reserved string) ([]uint8, error) {
+	if reserved == "" {
+		return nil, nil
+	}
+
+	// "1,2,3" form
+	if strings.Contains(reserved, ",") {
+		parts := strings.Split(reserved, ",")
+		if len(parts) != 3 {
+			return nil, paramError(StageOptions, "reserved", CodeInvalidParam, "parseWireGuardReserved: reserved must contain 3 bytes")
+		}
+		result := make([]uint8, 0, 3)
+		for _, part := range parts {
+			b, err := strconv.ParseUint(strings.TrimSpace(part), 10, 8)
+			if err != nil {
+				return nil, paramError(StageOptions, "reserved", CodeInvalidParam, "parseWireGuardReserved: invalid byte %s", part)
+			}
+			result = append(result, uint8(b))
+		}
+		return result, nil
+	}
+
+	// base64 form
+	decoded, err := base64.StdEncoding.DecodeString(fixWireGuardKey(reserved))
+	if err != nil {
+		return nil, fmt.Errorf("parseWireGuardReserved: %w", err)
+	}
+	if len(decoded) != 3 {
+		return nil, paramError(StageOptions, "reserved", CodeInvalidParam, "parseWireGuardReserved: reserved must contain 3 bytes")
+	}
+	return decoded, nil
+}
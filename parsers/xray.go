@@ -0,0 +1,398 @@
+package parsers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type xrayConfig struct {
+	Remarks   string         `json:"remarks"`
+	Outbounds []xrayOutbound `json:"outbounds"`
+}
+
+type xrayOutbound struct {
+	Protocol       string             `json:"protocol"`
+	Tag            string             `json:"tag"`
+	Settings       xraySettings       `json:"settings"`
+	StreamSettings xrayStreamSettings `json:"streamSettings"`
+}
+
+type xraySettings struct {
+	Vnext   []xrayServer `json:"vnext"`
+	Servers []xrayServer `json:"servers"`
+}
+
+type xrayServer struct {
+	Address  string     `json:"address"`
+	Port     int        `json:"port"`
+	Users    []xrayUser `json:"users"`
+	Password string     `json:"password"`
+	Method   string     `json:"method"`
+	Flow     string     `json:"flow"`
+}
+
+type xrayUser struct {
+	ID       string `json:"id"`
+	AlterID  int    `json:"alterId"`
+	Security string `json:"security"`
+	Flow     string `json:"flow"`
+	User     string `json:"user"`
+	Pass     string `json:"pass"`
+}
+
+type xrayStreamSettings struct {
+	Network             string              `json:"network"`
+	Security            string              `json:"security"`
+	TLSSettings         xrayTLSSettings     `json:"tlsSettings"`
+	RealitySettings     xrayRealitySettings `json:"realitySettings"`
+	TCPSettings         xrayTCPSettings     `json:"tcpSettings"`
+	WSSettings          xrayWSSettings      `json:"wsSettings"`
+	HTTPUpgradeSettings xrayWSSettings      `json:"httpupgradeSettings"`
+	HTTPSettings        xrayHTTPSettings    `json:"httpSettings"`
+	GRPCSettings        xrayGRPCSettings    `json:"grpcSettings"`
+}
+
+type xrayTLSSettings struct {
+	ServerName    string   `json:"serverName"`
+	AllowInsecure bool     `json:"allowInsecure"`
+	ALPN          []string `json:"alpn"`
+	Fingerprint   string   `json:"fingerprint"`
+}
+
+type xrayRealitySettings struct {
+	ServerName  string `json:"serverName"`
+	Fingerprint string `json:"fingerprint"`
+	PublicKey   string `json:"publicKey"`
+	ShortID     string `json:"shortId"`
+	SpiderX     string `json:"spiderX"`
+}
+
+type xrayTCPSettings struct {
+	Header struct {
+		Type    string `json:"type"`
+		Request struct {
+			Path    []string            `json:"path"`
+			Headers map[string][]string `json:"headers"`
+		} `json:"request"`
+	} `json:"header"`
+}
+
+type xrayWSSettings struct {
+	Path    string            `json:"path"`
+	Host    string            `json:"host"`
+	Headers map[string]string `json:"headers"`
+}
+
+type xrayHTTPSettings struct {
+	Host []string `json:"host"`
+	Path string   `json:"path"`
+}
+
+type xrayGRPCSettings struct {
+	ServiceName string `json:"serviceName"`
+	Authority   string `json:"authority"`
+}
+
+// IsXrayConfig reports whether content is an Xray/V2Ray client config (or a list of them).
+// Must be checked before IsSingBoxConfig, since both have an "outbounds" array.
+func IsXrayConfig(content string) bool {
+	configs, err := decodeXrayConfigs([]byte(content))
+	if err != nil {
+		return false
+	}
+	for _, config := range configs {
+		for _, o := range config.Outbounds {
+			if o.Protocol != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeXrayConfigs(content []byte) ([]xrayConfig, error) {
+	trimmed := strings.TrimSpace(string(content))
+
+	if strings.HasPrefix(trimmed, "[") {
+		var configs []xrayConfig
+		if err := json.Unmarshal([]byte(trimmed), &configs); err != nil {
+			return nil, err
+		}
+		return configs, nil
+	}
+
+	var config xrayConfig
+	if err := json.Unmarshal([]byte(trimmed), &config); err != nil {
+		return nil, err
+	}
+	return []xrayConfig{config}, nil
+}
+
+// ParseXrayConfig converts proxy outbounds of Xray/V2Ray client configs into profiles,
+// one per server and user. Share URIs are synthesized and fed through the regular
+// parsers, so stream settings are validated exactly like on the URI path.
+func ParseXrayConfig(content []byte) ([]ProxyProfile, []error) {
+	configs, err := decodeXrayConfigs(content)
+	if err != nil {
+		return nil, []error{fmt.Errorf("ParseXrayConfig: %w", err)}
+	}
+
+	var profiles []ProxyProfile
+	var errs []error
+
+	for _, config := range configs {
+		for i, o := range config.Outbounds {
+			name := config.Remarks
+			if name == "" {
+				name = o.Tag
+			}
+
+			connURIs, err := xrayOutboundToURIs(o, name)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("ParseXrayConfig: outbound #%d (%s): %w", i, o.Tag, err))
+				continue
+			}
+
+			for _, connURI := range connURIs {
+				profile, err := ParseProfile(connURI)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("ParseXrayConfig: outbound #%d (%s): %w", i, o.Tag, err))
+					continue
+				}
+				profiles = append(profiles, *profile)
+			}
+		}
+	}
+
+	return profiles, errs
+}
+
+func xrayOutboundToURIs(o xrayOutbound, name string) ([]string, error) {
+	var uris []string
+
+	switch o.Protocol {
+	case "freedom", "blackhole", "dns", "loopback", "":
+		return nil, nil
+	case "vless", "vmess":
+		query, err := xrayStreamToQuery(o.StreamSettings)
+		if err != nil {
+			return nil, fmt.Errorf("xrayOutboundToURIs: %w", err)
+		}
+		for _, server := range o.Settings.Vnext {
+			for _, user := range server.Users {
+				if o.Protocol == "vless" {
+					q := cloneValues(query)
+					if user.Flow != "" {
+						q.Set("flow", user.Flow)
+					}
+					uris = append(uris, xrayURI("vless", url.User(user.ID), server, q, name))
+				} else {
+					uri, err := xrayVMessURI(server, user, query, name)
+					if err != nil {
+						return nil, fmt.Errorf("xrayOutboundToURIs: %w", err)
+					}
+					uris = append(uris, uri)
+				}
+			}
+		}
+	case "trojan":
+		query, err := xrayStreamToQuery(o.StreamSettings)
+		if err != nil {
+			return nil, fmt.Errorf("xrayOutboundToURIs: %w", err)
+		}
+		for _, server := range o.Settings.Servers {
+			q := cloneValues(query)
+			if server.Flow != "" {
+				q.Set("flow", server.Flow)
+			}
+			uris = append(uris, xrayURI("trojan", url.User(server.Password), server, q, name))
+		}
+	case "shadowsocks":
+		for _, server := range o.Settings.Servers {
+			uris = append(uris, xrayURI("ss", url.UserPassword(server.Method, server.Password), server, url.Values{}, name))
+		}
+	case "socks", "http":
+		scheme := "socks5"
+		if o.Protocol == "http" {
+			scheme = "http"
+			if o.StreamSettings.Security == "tls" {
+				scheme = "https"
+			}
+		}
+		for _, server := range o.Settings.Servers {
+			var user *url.Userinfo
+			if len(server.Users) > 0 {
+				user = url.UserPassword(server.Users[0].User, server.Users[0].Pass)
+			}
+			uris = append(uris, xrayURI(scheme, user, server, url.Values{}, name))
+		}
+	default:
+		return nil, fmt.Errorf("xrayOutboundToURIs: unsupported protocol %s", o.Protocol)
+	}
+
+	if len(uris) == 0 {
+		return nil, errors.New("xrayOutboundToURIs: no servers found")
+	}
+
+	return uris, nil
+}
+
+func xrayURI(scheme string, user *url.Userinfo, server xrayServer, query url.Values, name string) string {
+	u := &url.URL{
+		Scheme:   scheme,
+		User:     user,
+		Host:     net.JoinHostPort(server.Address, strconv.Itoa(server.Port)),
+		RawQuery: query.Encode(),
+		Fragment: name,
+	}
+	return u.String()
+}
+
+// xrayStreamToQuery maps streamSettings onto the query keys of vless/trojan share links,
+// which buildOutboundTLSOptions and buildV2RayTransportOptions understand
+func xrayStreamToQuery(stream xrayStreamSettings) (url.Values, error) {
+	query := url.Values{}
+
+	network := stream.Network
+	if network == "" {
+		network = "tcp"
+	}
+	query.Set("type", network)
+
+	switch stream.Security {
+	case "", "none":
+		query.Set("security", "none")
+	case "tls":
+		query.Set("security", "tls")
+		setIfNotEmpty(query, "sni", stream.TLSSettings.ServerName)
+		setIfNotEmpty(query, "fp", stream.TLSSettings.Fingerprint)
+		setIfNotEmpty(query, "alpn", strings.Join(stream.TLSSettings.ALPN, ","))
+		if stream.TLSSettings.AllowInsecure {
+			query.Set("allowInsecure", "1")
+		}
+	case "reality":
+		query.Set("security", "reality")
+		setIfNotEmpty(query, "sni", stream.RealitySettings.ServerName)
+		setIfNotEmpty(query, "fp", stream.RealitySettings.Fingerprint)
+		setIfNotEmpty(query, "pbk", stream.RealitySettings.PublicKey)
+		setIfNotEmpty(query, "sid", stream.RealitySettings.ShortID)
+		setIfNotEmpty(query, "spx", stream.RealitySettings.SpiderX)
+	default:
+		// Let buildOutboundTLSOptions report it
+		query.Set("security", stream.Security)
+	}
+
+	switch network {
+	case "tcp", "raw":
+		if headerType := stream.TCPSettings.Header.Type; headerType != "" && headerType != "none" {
+			query.Set("headerType", headerType)
+			if len(stream.TCPSettings.Header.Request.Path) > 0 {
+				query.Set("path", stream.TCPSettings.Header.Request.Path[0])
+			}
+			if hosts := stream.TCPSettings.Header.Request.Headers["Host"]; len(hosts) > 0 {
+				query.Set("host", strings.Join(hosts, ","))
+			}
+		}
+	case "ws", "websocket":
+		setIfNotEmpty(query, "path", stream.WSSettings.Path)
+		host := stream.WSSettings.Host
+		if host == "" {
+			host = stream.WSSettings.Headers["Host"]
+		}
+		setIfNotEmpty(query, "host", host)
+		addHeaderParams(query, stream.WSSettings.Headers)
+	case "httpupgrade":
+		setIfNotEmpty(query, "path", stream.HTTPUpgradeSettings.Path)
+		host := stream.HTTPUpgradeSettings.Host
+		if host == "" {
+			host = stream.HTTPUpgradeSettings.Headers["Host"]
+		}
+		setIfNotEmpty(query, "host", host)
+		addHeaderParams(query, stream.HTTPUpgradeSettings.Headers)
+	case "http", "h2":
+		setIfNotEmpty(query, "path", stream.HTTPSettings.Path)
+		setIfNotEmpty(query, "host", strings.Join(stream.HTTPSettings.Host, ","))
+	case "grpc":
+		setIfNotEmpty(query, "serviceName", stream.GRPCSettings.ServiceName)
+		setIfNotEmpty(query, "authority", stream.GRPCSettings.Authority)
+	}
+
+	// Validate early so unsupported stream settings are reported the same way as for URIs
+	if _, err := buildV2RayTransportOptions(query, "vless"); err != nil {
+		return nil, fmt.Errorf("xrayStreamToQuery: %w", err)
+	}
+	if _, err := buildOutboundTLSOptions(query, "vless"); err != nil {
+		return nil, fmt.Errorf("xrayStreamToQuery: %w", err)
+	}
+
+	return query, nil
+}
+
+// xrayVMessURI builds a v2rayN style vmess:// link from vless-keyed query parameters
+func xrayVMessURI(server xrayServer, user xrayUser, query url.Values, name string) (string, error) {
+	security := user.Security
+	if security == "" {
+		security = "auto"
+	}
+
+	fields := map[string]any{
+		"v":    "2",
+		"ps":   name,
+		"add":  server.Address,
+		"port": strconv.Itoa(server.Port),
+		"id":   user.ID,
+		"aid":  strconv.Itoa(user.AlterID),
+		"scy":  security,
+		"net":  query.Get("type"),
+		"type": query.Get("headerType"),
+		"host": query.Get("host"),
+		"path": query.Get("path"),
+		"tls":  query.Get("security"),
+		"sni":  query.Get("sni"),
+		"alpn": query.Get("alpn"),
+		"fp":   query.Get("fp"),
+		"pbk":  query.Get("pbk"),
+		"sid":  query.Get("sid"),
+	}
+
+	if query.Get("type") == "grpc" {
+		fields["path"] = query.Get("serviceName")
+		fields["authority"] = query.Get("authority")
+	}
+	if query.Get("allowInsecure") == "1" {
+		fields["allowInsecure"] = "1"
+	}
+	if headers := vmessHeaders(query["header"]); headers != nil {
+		fields["headers"] = headers
+	}
+	if fields["tls"] == "none" {
+		fields["tls"] = ""
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("xrayVMessURI: %w", err)
+	}
+
+	return "vmess://" + base64.StdEncoding.EncodeToString(data), nil
+}
+
+func setIfNotEmpty(query url.Values, key string, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
+
+func cloneValues(values url.Values) url.Values {
+	clone := make(url.Values, len(values))
+	for k, v := range values {
+		clone[k] = append([]string(nil), v...)
+	}
+	return clone
+}
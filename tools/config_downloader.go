@@ -9,8 +9,51 @@ import (
 	"os"
 	"strings"
 	"time"
+
+	"github.com/bluegradienthorizon/singtoolbox/parsers"
 )
 
+// SourceMarker prefixes the line naming the source of the configs that follow it
+const SourceMarker = "#!source "
+
+// configFormat is a whole-document subscription format whose profiles are converted to share links
+type configFormat struct {
+	name   string
+	detect func(content string) bool
+	parse  func(content []byte) ([]parsers.ProxyProfile, []error)
+}
+
+// Sing-box configs also have "outbounds", so the more specific Xray check goes first
+var configFormats = []configFormat{
+	{name: "Xray", detect: parsers.IsXrayConfig, parse: parsers.ParseXrayConfig},
+	{name: "sing-box", detect: parsers.IsSingBoxConfig, parse: parsers.ParseSingBoxConfig},
+	{name: "Clash", detect: parsers.IsClashConfig, parse: parsers.ParseClashConfig},
+}
+
+func detectConfigFormat(content string) (configFormat, bool) {
+	for _, format := range configFormats {
+		if format.detect(content) {
+			return format, true
+		}
+	}
+	return configFormat{}, false
+}
+
+// writeConvertedConfig writes the share links of every profile in content and reports
+// the skipped ones. It returns the number of links written.
+func writeConvertedConfig(outF *os.File, format configFormat, content []byte) int {
+	profiles, errs := format.parse(content)
+	for _, p := range profiles {
+		outF.WriteString(p.ConnURI + "\n")
+	}
+
+	fmt.Printf("    -> Successfully downloaded %s config. Converted %d profiles, skipped %d.\n", format.name, len(profiles), len(errs))
+	for _, err := range errs {
+		fmt.Printf("       %v\n", err)
+	}
+	return len(profiles)
+}
+
 func DownloadConfigs(inputFile string, outputFile string, timeout time.Duration) {
 	if _, err := os.Stat(outputFile); err == nil {
 		fmt.Printf("Output file '%s' exists. Redownload? y/n: ", outputFile)
@@ -51,16 +94,9 @@ func DownloadConfigs(inputFile string, outputFile string, timeout time.Duration)
 	for _, url := range links {
 		fmt.Printf("Processing: %s\n", url)
 
-		resp, err := client.Get(url)
+		body, err := fetchSource(client, url)
 		if err != nil {
-			fmt.Printf("    -> Error downloading %s. Skipping.\n", url)
-			continue
-		}
-
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil || resp.StatusCode != http.StatusOK {
-			fmt.Printf("    -> Error reading response from %s. Skipping.\n", url)
+			fmt.Printf("    -> Error reading %s: %v. Skipping.\n", url, err)
 			continue
 		}
 
@@ -84,6 +120,16 @@ func DownloadConfigs(inputFile string, outputFile string, timeout time.Duration)
 			fmt.Printf("    -> Error opening output file for append: %v\n", err)
 			continue
 		}
+		outF.WriteString(SourceMarker + url + "\n")
+
+		if format, ok := detectConfigFormat(content); ok {
+			configCount = writeConvertedConfig(outF, format, []byte(content))
+			outF.Close()
+
+			allConfigsCount += configCount
+			downloadSuccessCount++
+			continue
+		}
 
 		for _, line := range lines {
 			line = strings.TrimSpace(line)
@@ -112,6 +158,25 @@ func DownloadConfigs(inputFile string, outputFile string, timeout time.Duration)
 	fmt.Println("---")
 }
 
+// fetchSource downloads http(s) links and reads everything else as a local file path
+func fetchSource(client *http.Client, link string) ([]byte, error) {
+	if !strings.HasPrefix(link, "http://") && !strings.HasPrefix(link, "https://") {
+		return os.ReadFile(strings.TrimPrefix(link, "file://"))
+	}
+
+	resp, err := client.Get(link)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
 // Helper function to read non-empty, non-comment lines
 func readLines(path string) ([]string, error) {
 	file, err := os.Open(path)
@@ -0,0 +1,57 @@
+package tools
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadConfigsBase64WrappedDocuments(t *testing.T) {
+	documents := map[string]string{
+		"clash.yaml": `proxies:
+  - name: ss
+    type: ss
+    server: example.com
+    port: 8388
+    cipher: aes-256-gcm
+    password: secret
+`,
+		"singbox.json": `{"outbounds":[{"type":"trojan","tag":"t","server":"example.com","server_port":443,"password":"secret"}]}`,
+		"xray.json":    `{"outbounds":[{"protocol":"trojan","settings":{"servers":[{"address":"example.com","port":443,"password":"secret"}]}}]}`,
+	}
+
+	dir := t.TempDir()
+	var links []string
+	for name, document := range documents {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString([]byte(document))), 0644); err != nil {
+			t.Fatal(err)
+		}
+		links = append(links, path)
+	}
+
+	inputFile := filepath.Join(dir, "links.txt")
+	outputFile := filepath.Join(dir, "configs.txt")
+	if err := os.WriteFile(inputFile, []byte(strings.Join(links, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	DownloadConfigs(inputFile, outputFile, time.Second)
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var configs []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if !strings.HasPrefix(line, SourceMarker) {
+			configs = append(configs, line)
+		}
+	}
+	if len(configs) != len(documents) {
+		t.Errorf("got %d configs, want %d:\n%s", len(configs), len(documents), data)
+	}
+}
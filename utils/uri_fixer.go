@@ -8,11 +8,55 @@ import (
 	"strings"
 )
 
-func TryFixURI(uri string) (string, error) {
+// URIFix names a rewrite applied by TryFixURI
+type URIFix string
+
+const (
+	FixTrimSpace        URIFix = "trim_space"
+	FixInnerSpaces      URIFix = "inner_spaces"
+	FixMalformedPercent URIFix = "malformed_percent"
+	FixControlChars     URIFix = "control_chars"
+	FixUnescape         URIFix = "unescape"
+	// FixDecodedPercent drops a '%' that only appeared by decoding "%25", e.g. in a password
+	FixDecodedPercent URIFix = "decoded_percent"
+	FixHTMLEntities   URIFix = "html_entities"
+	FixEscapeUserInfo URIFix = "escape_userinfo"
+)
+
+// IsRepair reports whether the fix changes a broken link, as opposed to the decoding
+// that well-formed links go through as well. Only repairs mean the link needed repair.
+func (f URIFix) IsRepair() bool {
+	switch f {
+	case FixTrimSpace, FixUnescape, FixDecodedPercent, FixEscapeUserInfo:
+		return false
+	}
+	return true
+}
+
+// NeedsRepair reports whether any of the fixes is a repair
+func NeedsRepair(fixes []URIFix) bool {
+	for _, fix := range fixes {
+		if fix.IsRepair() {
+			return true
+		}
+	}
+	return false
+}
+
+// TryFixURI cleans up a share link and returns the fixes that changed it, in order
+func TryFixURI(uri string) (string, []URIFix, error) {
+	var fixes []URIFix
+	apply := func(fix URIFix, fixed string) {
+		if fixed != uri {
+			fixes = append(fixes, fix)
+			uri = fixed
+		}
+	}
+
 	// Fix №1: trim string
-	uri = strings.TrimSpace(uri)
+	apply(FixTrimSpace, strings.TrimSpace(uri))
 	if uri == "" {
-		return "", errors.New("empty URI")
+		return "", nil, errors.New("empty URI")
 	}
 
 	// Fix №2: remove spaces in url (before `#`)
@@ -27,35 +71,39 @@ func TryFixURI(uri string) (string, error) {
 	} else {
 		afterRemark = uri[beforeRemarkIndex+1:]
 	}
+	if strings.Contains(beforeRemark, " ") {
+		fixes = append(fixes, FixInnerSpaces)
+	}
+	// The appended empty remark is not worth a trace entry
 	beforeRemark = strings.ReplaceAll(beforeRemark, " ", "")
 	uri = beforeRemark + "#" + afterRemark
 
 	// Fix №3: clean malformed percent encoding
-	uri = cleanMalformedPercentEncoding(uri)
+	apply(FixMalformedPercent, cleanMalformedPercentEncoding(uri))
 
 	// Fix №4: remove control characterss
-	uri = removePercentEncodedControlCharacters(uri)
+	apply(FixControlChars, removePercentEncodedControlCharacters(uri))
 
 	// Fix №5: unescape uri (percent encoding)
-	uri, err := url.QueryUnescape(uri)
+	unescaped, err := url.QueryUnescape(uri)
 	if err != nil {
 		// Since the fix №3 is applied (and is correctly implemented) it should never return err
-		return "", err
+		return "", nil, err
 	}
+	apply(FixUnescape, unescaped)
 
 	// Fix №6: clean malformed percent encoding again
-	uri = cleanMalformedPercentEncoding(uri)
+	apply(FixDecodedPercent, cleanMalformedPercentEncoding(uri))
 
 	// Fix #7: escape all ampersands before unescaping to prevent some query params like "&note=" being unescaped to "¬e=" thus breaking params parsing later
-	uri = escapeAmpersands(uri)
-
 	// Fix №8: unescape string (html named entities like "&amp;")
-	uri = html.UnescapeString(uri)
+	// Together they only change the URI when it holds html entities
+	apply(FixHTMLEntities, html.UnescapeString(escapeAmpersands(uri)))
 
 	// Fix #9: escape user part
 	schemeSplit := strings.SplitN(uri, "://", 2)
 	if len(schemeSplit) != 2 {
-		return "", errors.New("failed to split URI by scheme")
+		return "", nil, errors.New("failed to split URI by scheme")
 	}
 	querySplit := strings.Split(schemeSplit[1], "?")
 	if len(querySplit) == 2 {
@@ -64,11 +112,11 @@ func TryFixURI(uri string) (string, error) {
 			user := querySplit[0][0:userSplitIndex]
 			addr := querySplit[0][userSplitIndex+1:]
 			userEscaped := url.QueryEscape(user)
-			uri = schemeSplit[0] + "://" + userEscaped + "@" + addr + "?" + querySplit[1]
+			apply(FixEscapeUserInfo, schemeSplit[0]+"://"+userEscaped+"@"+addr+"?"+querySplit[1])
 		}
 	}
 
-	return uri, nil
+	return uri, fixes, nil
 }
 
 func cleanMalformedPercentEncoding(input string) string {